@@ -2,41 +2,156 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/juju/errors"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/time/rate"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/figwasp/figwasp/pkg/figwasp"
 )
 
+const (
+	credsSourceDockerConfig = "dockerConfig"
+	credsSourcePullSecrets  = "imagePullSecrets"
+	credsSourceSecret       = "secret"
+)
+
+var (
+	credsOrderDefault = []string{
+		credsSourcePullSecrets,
+		credsSourceDockerConfig,
+		credsSourceSecret,
+	}
+)
+
 type FigwaspSwarm struct {
-	figwasps []*Figwasp
+	allowList     ImageAllowList
+	canaries      []*Figwasp                             // run before all waves
+	credsGetters  map[string]RepositoryCredentialsGetter // by source
+	credsOrder    []string
+	credsProvider RepositoryCredentialsProvider
+	credsSecret   string // "namespace/name"
+	figwasps      []*Figwasp
+	waves         [][]*Figwasp // in the order in which they are run
+	waiter        RolloutWaiter
+	rateLimiters  map[string]*rate.Limiter // by repository address
+	proxy         RegistryProxy
+	registries    RegistryConfiguration
+	rollout       rolloutPolicy
+	verifier      ImageSignatureVerifier // nil: signatures not verified
+
+	cacheTTL  time.Duration
+	nRollouts int
+	nWorkers  int
+	rateBurst int
+	rateLimit rate.Limit
+
+	retryAttempts     int
+	retryDelayInitial time.Duration
+	retryDelayMaximum time.Duration
+
+	canaryPeriod   time.Duration
+	rolloutTimeout time.Duration
 }
 
 func NewFigwaspSwarm(
 	config *rest.Config, namespace string, timeout time.Duration,
+	options ...figwaspSwarmOption,
 ) (
 	f *FigwaspSwarm, e error,
 ) {
 	const (
 		labelSelector = "figwasp/target=true"
+
+		nWorkersDefault  = 16
+		rateBurstDefault = 1
+
+		retryAttemptsDefault     = 1
+		retryDelayInitialDefault = time.Second
+		retryDelayMaximumDefault = time.Second
+
+		rolloutTimeoutDefault = time.Minute * 10
+		prePullTimeoutDefault = time.Minute * 5
 	)
 
 	var (
+		annotator            DeploymentAnnotator
+		cancel               context.CancelFunc
 		ctx                  context.Context
 		deploymentNameLister DeploymentNameLister
 		deploymentNames      []string
+		member               *Figwasp
 
+		cache       ImageDigestCache
 		credsGetter RepositoryCredentialsGetter
+		evictor     PodEvictor
+		health      HealthChecker
+		option      figwaspSwarmOption
+		pool        *ImageDigestRetrieverPool
+		prePuller   ImagePrePuller
+		recorder    EventRecorder
 		restarter   RolloutRestarter
-		retrievers  map[string]ImageDigestRetriever
+		rollouts    *RolloutLimiter
+		setter      ImageSetter
 
 		i int
 	)
 
+	f = &FigwaspSwarm{
+		credsGetters: make(map[string]RepositoryCredentialsGetter),
+		credsOrder:   credsOrderDefault,
+		rateLimiters: make(map[string]*rate.Limiter),
+		rollout: rolloutPolicy{
+			imageAgeSource: imageAgeSourceCreated,
+			prePullTimeout: prePullTimeoutDefault,
+		},
+
+		nWorkers:  nWorkersDefault,
+		rateBurst: rateBurstDefault,
+		rateLimit: rate.Inf,
+
+		retryAttempts:     retryAttemptsDefault,
+		retryDelayInitial: retryDelayInitialDefault,
+		retryDelayMaximum: retryDelayMaximumDefault,
+
+		rolloutTimeout: rolloutTimeoutDefault,
+	}
+
+	f.allowList, e = figwasp.NewImageAllowList() // all, unless restricted
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	for _, option = range options {
+		e = option(f)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	// the Kubernetes API is reached as before, not through the registry proxy
+	if f.proxy != nil {
+		config = rest.CopyConfig(config)
+
+		config.Proxy = proxyFromEnvironment(
+			httpproxy.FromEnvironment(),
+		)
+	}
+
 	deploymentNameLister, e = figwasp.NewLabelSelectorDeploymentNameLister(
 		config,
 		namespace,
@@ -48,7 +163,9 @@ func NewFigwaspSwarm(
 		return
 	}
 
-	ctx, _ = context.WithTimeout(background, timeout)
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
 
 	deploymentNames, e = deploymentNameLister.ListDeploymentNames(ctx)
 	if e != nil {
@@ -57,43 +174,155 @@ func NewFigwaspSwarm(
 		return
 	}
 
-	credsGetter, e = newCredsGetter(config, namespace, timeout)
+	if f.credsSecret != "" {
+		f.credsGetters[credsSourceSecret], e = newSecretCredsGetter(config,
+			namespace,
+			f.credsSecret,
+			timeout,
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	restarter, e = figwasp.NewDeploymentRolloutRestarter(config, namespace)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
-	restarter, e = figwasp.NewDeploymentRolloutRestarter(config, namespace)
+	evictor, e = figwasp.NewPodEvictor(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	health, e = figwasp.NewDeploymentHealthChecker(config, namespace)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
-	retrievers = make(map[string]ImageDigestRetriever)
+	prePuller, e = figwasp.NewImagePrePuller(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
 
-	f = &FigwaspSwarm{
-		figwasps: make([]*Figwasp,
-			len(deploymentNames),
-		),
+		return
+	}
+
+	setter, e = figwasp.NewDeploymentImageSetter(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f.waiter, e = figwasp.NewDeploymentRolloutWaiter(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	rollouts, e = NewRolloutLimiter(f.nRollouts, f.waiter, f.rolloutTimeout)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	annotator, e = figwasp.NewDeploymentAnnotator(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	recorder, e = figwasp.NewDeploymentEventRecorder(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	cache, e = figwasp.NewImageDigestCache(f.cacheTTL)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	pool, e = NewImageDigestRetrieverPool(cache, f.nWorkers, f.newRetriever)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
 	}
 
 	for i = 0; i < len(deploymentNames); i++ {
-		f.figwasps[i], e = NewFigwasp(
+		credsGetter, e = f.newCredsGetter(config,
+			namespace,
+			deploymentNames[i],
+			timeout,
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		member, e = NewFigwasp(
 			config,
 			namespace,
 			deploymentNames[i],
 			timeout,
-			credsGetter,
+			pool,
+			rollouts,
+			f.allowList,
 			restarter,
-			retrievers,
+			evictor,
+			health,
+			prePuller,
+			setter,
+			annotator,
+			recorder,
+			f.verifier,
+			f.rollout,
+			credsGetter,
+			f.credsProvider,
 		)
+
+		// skipped, and reported, but not fatal to the rest
+		if errors.IsForbidden(e) {
+			e = reportNotAllowed(deploymentNames[i], e, recorder, timeout)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			continue
+		}
+
 		if e != nil {
 			e = errors.Trace(e)
 
 			return
 		}
+
+		f.figwasps = append(f.figwasps, member)
+	}
+
+	e = f.orderWaves()
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
 	}
 
 	return
@@ -101,31 +330,36 @@ func NewFigwaspSwarm(
 
 func (f *FigwaspSwarm) Run() (e error) {
 	var (
-		errorChannel chan error
-		waitGroup    *sync.WaitGroup
+		blocked map[string]bool // images of canaries unhealthy or pending
+		failure error
 
-		figwasp *Figwasp
+		i    int
+		wave []*Figwasp
 	)
 
-	errorChannel = make(chan error,
-		len(f.figwasps),
-	)
+	blocked, failure, e = f.runCanaries()
+	if e != nil {
+		e = errors.Trace(e)
 
-	waitGroup = new(sync.WaitGroup)
+		return
+	}
 
-	waitGroup.Add(
-		len(f.figwasps),
-	)
+	// each wave is rolled out, and healthy, before the next is begun
+	for i, wave = range f.waves {
+		wave = withoutImages(wave, blocked)
 
-	for _, figwasp = range f.figwasps {
-		go figwasp.RunConcurrently(errorChannel, waitGroup)
-	}
+		e = runWave(wave)
+		if e != nil {
+			e = errors.Trace(e)
 
-	waitGroup.Wait()
+			return
+		}
 
-	close(errorChannel)
+		if i == len(f.waves)-1 {
+			break
+		}
 
-	for e = range errorChannel {
+		e = f.waitForWave(wave)
 		if e != nil {
 			e = errors.Trace(e)
 
@@ -133,43 +367,808 @@ func (f *FigwaspSwarm) Run() (e error) {
 		}
 	}
 
+	if failure != nil {
+		e = errors.Trace(failure)
+
+		return
+	}
+
 	return
 }
 
-func newCredsGetter(
-	config *rest.Config, namespace string, timeout time.Duration,
-) (
-	credsGetter RepositoryCredentialsGetter, e error,
+func (f *FigwaspSwarm) runCanaries() (
+	blocked map[string]bool, failure error, e error,
 ) {
 	var (
-		ctx          context.Context
-		secretList   []v1.Secret
-		secretLister SecretLister
+		canary    *Figwasp
+		cancel    context.CancelFunc
+		ctx       context.Context
+		failures  []string
+		period    time.Duration
+		reference figwasp.ImageReference
 	)
 
-	secretLister, e = figwasp.NewSecretLister(config, namespace)
+	blocked = make(map[string]bool)
+
+	e = runWave(f.canaries)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
-	ctx, _ = context.WithTimeout(background, timeout)
+	// canaries restarted by an earlier run are checked too, as the rest
+	// were not restarted then and may be now
+	for _, canary = range f.canaries {
+		// until a canary has rolled out a change found, the rest wait for it
+		if canary.pending {
+			log.Printf("deployment %s: canary not restarted, "+
+				"holding back deployments using its images",
+				canary.deployment,
+			)
 
-	secretList, e = secretLister.ListSecrets(ctx)
-	if e != nil {
-		e = errors.Trace(e)
+			for _, reference = range canary.references {
+				blocked[reference.NamedAndTagged] = true
+			}
 
-		return
+			continue
+		}
+
+		period = 0
+
+		if canary.rolledOut {
+			period = f.canaryPeriod
+		}
+
+		ctx, cancel = context.WithTimeout(background,
+			f.rolloutTimeout+period,
+		)
+
+		e = f.waiter.WaitForRollout(canary.deployment, ctx)
+		if e == nil {
+			e = f.waiter.WatchRollout(canary.deployment, period, ctx)
+		}
+
+		cancel()
+
+		if e != nil {
+			for _, reference = range canary.references {
+				blocked[reference.NamedAndTagged] = true
+			}
+
+			log.Printf("deployment %s: canary failed, "+
+				"holding back deployments using its images, %s",
+				canary.deployment,
+				e,
+			)
+
+			failures = append(failures,
+				fmt.Sprintf("canary %s: %s", canary.deployment, e),
+			)
+
+			e = nil
+		}
 	}
 
-	credsGetter, e =
-		figwasp.NewRepositoryCredentialsGetterFromKubernetesSecrets(secretList)
+	// every canary failing is reported, once the rest have been run
+	if len(failures) > 0 {
+		failure = errors.New(
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return
+}
+
+func (f *FigwaspSwarm) waitForWave(wave []*Figwasp) (e error) {
+	var (
+		cancel  context.CancelFunc
+		ctx     context.Context
+		figwasp *Figwasp
+	)
+
+	for _, figwasp = range wave {
+		if !figwasp.rolledOut {
+			continue
+		}
+
+		ctx, cancel = context.WithTimeout(background, f.rolloutTimeout)
+
+		e = f.waiter.WaitForRollout(figwasp.deployment, ctx)
+
+		cancel()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (f *FigwaspSwarm) orderWaves() (e error) {
+	var (
+		after   map[string][]string
+		byName  map[string]*Figwasp
+		member  *Figwasp
+		name    string
+		names   []string
+		ordered [][]string
+		waves   map[string]int
+
+		i int
+	)
+
+	after = make(map[string][]string)
+
+	byName = make(map[string]*Figwasp)
+
+	waves = make(map[string]int)
+
+	for _, member = range f.figwasps {
+		if member.canary {
+			f.canaries = append(f.canaries, member)
+
+			continue
+		}
+
+		after[member.deployment] = member.after
+
+		byName[member.deployment] = member
+
+		waves[member.deployment] = member.wave
+	}
+
+	ordered, e = figwasp.OrderRestartWaves(waves, after)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
+	f.waves = make([][]*Figwasp,
+		len(ordered),
+	)
+
+	for i, names = range ordered {
+		for _, name = range names {
+			f.waves[i] = append(f.waves[i], byName[name])
+		}
+	}
+
+	return
+}
+
+func withoutImages(figwasps []*Figwasp, images map[string]bool) (
+	remaining []*Figwasp,
+) {
+	var (
+		figwasp *Figwasp
+	)
+
+	for _, figwasp = range figwasps {
+		if !figwasp.usesAnyImage(images) {
+			remaining = append(remaining, figwasp)
+		}
+	}
+
+	return
+}
+
+func runWave(figwasps []*Figwasp) (e error) {
+	var (
+		errorChannel chan error
+		waitGroup    *sync.WaitGroup
+
+		figwasp *Figwasp
+	)
+
+	errorChannel = make(chan error,
+		len(figwasps),
+	)
+
+	waitGroup = new(sync.WaitGroup)
+
+	waitGroup.Add(
+		len(figwasps),
+	)
+
+	for _, figwasp = range figwasps {
+		go figwasp.RunConcurrently(errorChannel, waitGroup)
+	}
+
+	waitGroup.Wait()
+
+	close(errorChannel)
+
+	for e = range errorChannel {
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (f *FigwaspSwarm) Destroy() (e error) {
+	if f.proxy != nil {
+		e = f.proxy.Close()
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	if f.registries != nil {
+		e = f.registries.Destroy()
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (f *FigwaspSwarm) newRetriever(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+) (
+	retriever ImageDigestRetriever, e error,
+) {
+	var (
+		found bool
+
+		pathToCertDir        string // "": default
+		pathToRegistriesConf string // "": default
+	)
+
+	// called by ImageDigestRetrieverPool holding its lock
+	_, found = f.rateLimiters[reference.RepositoryAddress]
+	if !found {
+		f.rateLimiters[reference.RepositoryAddress] = rate.NewLimiter(
+			f.rateLimit,
+			f.rateBurst,
+		)
+	}
+
+	if f.registries != nil {
+		pathToCertDir = f.registries.PathToCertificateDirectory()
+
+		pathToRegistriesConf = f.registries.PathToRegistriesConfiguration()
+	}
+
+	retriever, e = figwasp.NewImageDigestRetriever(
+		figwasp.WithBasicAuthentication(
+			credentials.username,
+			credentials.password,
+		),
+		figwasp.WithIdentityToken(credentials.identityToken),
+		figwasp.WithBearerToken(credentials.registryToken),
+		figwasp.WithRateLimiter(
+			f.rateLimiters[reference.RepositoryAddress],
+		),
+		figwasp.WithRetries(
+			f.retryAttempts,
+			f.retryDelayInitial,
+			f.retryDelayMaximum,
+		),
+		figwasp.WithPerHostCertificateDirectory(pathToCertDir),
+		figwasp.WithRegistriesConfiguration(pathToRegistriesConf),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *FigwaspSwarm) newCredsGetter(
+	config *rest.Config, namespace, deployment string, timeout time.Duration,
+) (
+	credsGetter RepositoryCredentialsGetter, e error,
+) {
+	var (
+		found   bool
+		getter  RepositoryCredentialsGetter
+		getters []RepositoryCredentialsGetter
+		source  string
+	)
+
+	for _, source = range f.credsOrder {
+		if source == credsSourcePullSecrets {
+			getter, e = newPullSecretCredsGetter(config,
+				namespace,
+				deployment,
+				timeout,
+			)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			getters = append(getters, getter)
+
+			continue
+		}
+
+		getter, found = f.credsGetters[source]
+		if found {
+			getters = append(getters, getter)
+		} // sources not configured are skipped
+	}
+
+	credsGetter = newRepositoryCredentialsGetterChain(getters...)
+
+	return
+}
+
+func newPullSecretCredsGetter(
+	config *rest.Config, namespace, deployment string, timeout time.Duration,
+) (
+	credsGetter RepositoryCredentialsGetter, e error,
+) {
+	var (
+		cancel       context.CancelFunc
+		ctx          context.Context
+		secretList   []v1.Secret
+		secretLister ImagePullSecretLister
+	)
+
+	secretLister, e = figwasp.NewDeploymentImagePullSecretLister(config,
+		namespace,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
+
+	secretList, e = secretLister.ListImagePullSecrets(deployment, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	credsGetter, e =
+		figwasp.NewRepositoryCredentialsGetterFromKubernetesSecrets(secretList)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func newSecretCredsGetter(
+	config *rest.Config, namespaceDefault, namespacedName string,
+	timeout time.Duration,
+) (
+	credsGetter RepositoryCredentialsGetter, e error,
+) {
+	var (
+		cancel       context.CancelFunc
+		ctx          context.Context
+		name         string
+		namespace    string
+		secret       v1.Secret
+		secretGetter SecretGetter
+	)
+
+	namespace, name, e = cache.SplitMetaNamespaceKey(namespacedName)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if namespace == "" {
+		namespace = namespaceDefault
+	}
+
+	secretGetter, e = figwasp.NewSecretGetter(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
+
+	secret, e = secretGetter.GetSecret(name, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	credsGetter, e = figwasp.NewRepositoryCredentialsGetterFromKubernetesSecrets(
+		[]v1.Secret{secret},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+type figwaspSwarmOption func(*FigwaspSwarm) error
+
+func WithWorkers(nWorkers int) (option figwaspSwarmOption) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.nWorkers = nWorkers
+
+		return
+	}
+
+	return
+}
+
+func WithMaximumConcurrentRollouts(
+	nRollouts int, rolloutTimeout time.Duration,
+) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.nRollouts = nRollouts // 0: no limit
+
+		f.rolloutTimeout = rolloutTimeout
+
+		return
+	}
+
+	return
+}
+
+func WithCanaryPeriod(canaryPeriod time.Duration) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if canaryPeriod < 0 {
+			e = errors.NotValidf("canary period %s", canaryPeriod)
+
+			return
+		}
+
+		f.canaryPeriod = canaryPeriod
+
+		return
+	}
+
+	return
+}
+
+func WithPrePullTimeout(prePullTimeout time.Duration) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if prePullTimeout <= 0 {
+			e = errors.NotValidf("pre-pull timeout %s", prePullTimeout)
+
+			return
+		}
+
+		f.rollout.prePullTimeout = prePullTimeout
+
+		return
+	}
+
+	return
+}
+
+func WithImageDigestCacheTTL(cacheTTL time.Duration) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.cacheTTL = cacheTTL // 0: digests are cached for the whole run
+
+		return
+	}
+
+	return
+}
+
+func WithRegistryRateLimit(rateLimit float64, rateBurst int) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if rateLimit <= 0 {
+			return // no limit
+		}
+
+		if rateBurst < 1 {
+			e = errors.NotValidf("rate limit burst %d", rateBurst)
+
+			return
+		}
+
+		f.rateLimit = rate.Limit(rateLimit) // requests per second per registry
+
+		f.rateBurst = rateBurst
+
+		return
+	}
+
+	return
+}
+
+func WithRegistryRetries(
+	attempts int, delayInitial, delayMaximum time.Duration,
+) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.retryAttempts = attempts
+
+		f.retryDelayInitial = delayInitial
+
+		f.retryDelayMaximum = delayMaximum
+
+		return
+	}
+
+	return
+}
+
+func WithCredentialProvider(pathToConfig, pathToBinDir string) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if pathToConfig == "" {
+			return // imagePullSecrets only
+		}
+
+		f.credsProvider, e = figwasp.NewCredentialProviderGetterFromConfigFile(
+			pathToConfig,
+			pathToBinDir,
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithCredentialSourceOrder(sources []string) (option figwaspSwarmOption) {
+	option = func(f *FigwaspSwarm) (e error) {
+		var (
+			source string
+		)
+
+		for _, source = range sources {
+			switch source {
+			case credsSourcePullSecrets, credsSourceDockerConfig,
+				credsSourceSecret:
+
+			default:
+				e = errors.NotValidf("credential source %q", source)
+
+				return
+			}
+		}
+
+		f.credsOrder = sources
+
+		return
+	}
+
+	return
+}
+
+func WithDockerConfigFile(pathToConfig string) (option figwaspSwarmOption) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if pathToConfig == "" {
+			return
+		}
+
+		f.credsGetters[credsSourceDockerConfig], e =
+			figwasp.NewRepositoryCredentialsGetterFromDockerConfigFile(
+				pathToConfig,
+			)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithCredentialsSecret(namespacedName string) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.credsSecret = namespacedName // read once options are applied
+
+		return
+	}
+
+	return
+}
+
+func WithAllowedImages(locations []string) (option figwaspSwarmOption) {
+	option = func(f *FigwaspSwarm) (e error) {
+		f.allowList, e = figwasp.NewImageAllowList(locations...)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithSignatureVerification(pathsToPublicKeys []string) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if len(pathsToPublicKeys) == 0 {
+			return
+		}
+
+		f.verifier, e = figwasp.NewImageSignatureVerifier(
+			pathsToPublicKeys...,
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithRegistryConfiguration(pathToConfig string) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if pathToConfig == "" {
+			return
+		}
+
+		f.registries, e = figwasp.NewRegistryConfigurationFromFile(pathToConfig)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if len(f.registries.Proxies()) == 0 {
+			return
+		}
+
+		f.proxy, e = figwasp.NewRegistryProxy(
+			f.registries.Proxies(),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = setRegistryTransportProxy(
+			f.proxy.URL(),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithMinimumImageAge(age time.Duration, source string) (
+	option figwaspSwarmOption,
+) {
+	option = func(f *FigwaspSwarm) (e error) {
+		if age < 0 {
+			e = errors.NotValidf("minimum image age %s", age)
+
+			return
+		}
+
+		switch source {
+		case imageAgeSourceCreated, imageAgeSourceObserved:
+
+		default:
+			e = errors.NotValidf("image age source %q", source)
+
+			return
+		}
+
+		f.rollout.minimumImageAge = age // 0: new digests are acted on at once
+
+		f.rollout.imageAgeSource = source
+
+		return
+	}
+
+	return
+}
+
+func reportNotAllowed(
+	deploymentName string, notAllowed error, recorder EventRecorder,
+	timeout time.Duration,
+) (
+	e error,
+) {
+	const (
+		reason = "ImageNotAllowed"
+	)
+
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	log.Printf("deployment %s: skipped, %s", deploymentName, notAllowed)
+
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
+
+	e = recorder.RecordWarning(deploymentName,
+		reason,
+		notAllowed.Error(),
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func proxyFromEnvironment(environment *httpproxy.Config) (
+	proxy func(*http.Request) (*url.URL, error),
+) {
+	var (
+		proxyFunc func(*url.URL) (*url.URL, error)
+	)
+
+	proxyFunc = environment.ProxyFunc()
+
+	proxy = func(request *http.Request) (*url.URL, error) {
+		return proxyFunc(request.URL)
+	}
+
 	return
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFigwaspSwarmRunCanaries(t *testing.T) {
+	const (
+		canaryPeriod    = 5 * time.Minute
+		minimumImageAge = time.Hour
+	)
+
+	type testCase struct {
+		canaries []*Figwasp
+		failures map[string]error // of rollouts, by deployment name
+		blocked  bool             // testImageDeployed
+		watched  map[string]time.Duration
+		failed   []string // canaries reported
+	}
+
+	var (
+		testCases map[string]testCase
+
+		blocked map[string]bool
+		canary  string
+		failure error
+		member  *Figwasp
+		name    string
+		swarm   *FigwaspSwarm
+		test    testCase
+		waiter  *fakeRolloutWaiter
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"a canary not yet rolled out holds back its images": {
+			canaries: []*Figwasp{
+				newFakeFigwasp(t, "pending", testTagSelected, time.Now(),
+					rolloutPolicy{
+						minimumImageAge: minimumImageAge,
+						imageAgeSource:  imageAgeSourceCreated,
+					},
+				),
+			},
+			blocked: true,
+		},
+		"a canary is watched only once rolled out": {
+			canaries: []*Figwasp{
+				newFakeFigwasp(t, "rolled-out", testTagSelected, time.Now(),
+					rolloutPolicy{},
+				),
+				newFakeFigwasp(t, "unchanged", testTagDeployed, time.Now(),
+					rolloutPolicy{},
+				),
+			},
+			watched: map[string]time.Duration{
+				"rolled-out": canaryPeriod,
+				"unchanged":  0,
+			},
+		},
+		"failed canaries hold back their images and are all reported": {
+			canaries: []*Figwasp{
+				newFakeFigwasp(t, "failed", testTagSelected, time.Now(),
+					rolloutPolicy{},
+				),
+				newFakeFigwasp(t, "unavailable", testTagDeployed, time.Now(),
+					rolloutPolicy{},
+				),
+			},
+			failures: map[string]error{
+				"failed":      errors.New("progress deadline exceeded"),
+				"unavailable": errors.New("1 of 2 replicas unavailable"),
+			},
+			blocked: true,
+			failed:  []string{"failed", "unavailable"},
+		},
+	}
+
+	for name, test = range testCases {
+		waiter = &fakeRolloutWaiter{
+			failures: test.failures,
+		}
+
+		// a later wave using the same image, to be held back if blocked
+		member = newFakeFigwasp(t, testDeployment, testTagSelected,
+			time.Now(),
+			rolloutPolicy{},
+		)
+
+		swarm = &FigwaspSwarm{
+			canaries: test.canaries,
+			waves:    [][]*Figwasp{{member}},
+			waiter:   waiter,
+
+			canaryPeriod:   canaryPeriod,
+			rolloutTimeout: testTimeout,
+		}
+
+		blocked, failure, e = swarm.runCanaries()
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t,
+			test.blocked,
+			blocked[test.canaries[0].references[0].NamedAndTagged],
+			name,
+		)
+
+		if test.watched != nil {
+			assert.Equal(t, test.watched, waiter.watched, name)
+		}
+
+		if test.failed == nil {
+			assert.NoError(t, failure, name)
+
+		} else if assert.Error(t, failure, name) {
+			for _, canary = range test.failed {
+				assert.Contains(t, failure.Error(), "canary "+canary, name)
+			}
+		}
+
+		e = swarm.Run()
+
+		if test.failed == nil {
+			assert.NoError(t, e, name)
+
+		} else {
+			assert.Error(t, e, name)
+		}
+
+		if test.blocked {
+			assert.Nil(t, member.setter.(*fakeImageSetter).images, name)
+
+		} else {
+			assert.NotNil(t, member.setter.(*fakeImageSetter).images, name)
+		}
+	}
+}
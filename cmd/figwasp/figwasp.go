@@ -2,192 +2,1956 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 
 	"github.com/figwasp/figwasp/pkg/figwasp"
 )
 
+const (
+	imageAgeSourceCreated  = "created"
+	imageAgeSourceObserved = "observed"
+
+	observedAnnotationKey = "figwasp/observedDigests"
+	deferralAnnotationKey = "figwasp/deferredRestart"
+	skippedAnnotationKey  = "figwasp/skippedRestarts"
+	evictedAnnotationKey  = "figwasp/evictedAt"
+)
+
 type Figwasp struct {
-	credsGetter RepositoryCredentialsGetter
+	allowList   ImageAllowList
+	annotator   DeploymentAnnotator
+	credentials map[string]repositoryCredentials // by repository name
+	deferral    *restartDeferral
+	evictor     PodEvictor
+	health      HealthChecker
+	images      map[string]containerImage   // by container name
+	observed    map[string]imageObservation // by image reference
+	policy      TagPolicy
+	timestamps  TimestampTagPolicy
+	pool        *ImageDigestRetrieverPool
+	prePuller   ImagePrePuller
+	recorder    EventRecorder
 	references  []figwasp.ImageReference
+	refLister   ImageReferenceLister
 	restarter   RolloutRestarter
-	retrievers  map[string]ImageDigestRetriever
+	rollout     rolloutPolicy
+	rollouts    *RolloutLimiter
+	schedule    RestartSchedule
+	setter      ImageSetter
+	verifier    ImageSignatureVerifier // nil: signatures not verified
+
+	cooldown        time.Duration
+	restartedAt     time.Time
+	skippedRestarts int
+
+	after     []string // deployment names
+	canary    bool
+	evict     bool // stale pods only, in place of a rollout restart
+	prePull   bool // new images onto nodes, before the rollout
+	wave      int
+	pending   bool // a change found, but not yet rolled out
+	rolledOut bool
+
+	deployment string
+	timeout    time.Duration
+}
+
+func NewFigwasp(
+	config *rest.Config, namespace, deployment string, timeout time.Duration,
+	pool *ImageDigestRetrieverPool, rollouts *RolloutLimiter,
+	allowList ImageAllowList,
+	restarter RolloutRestarter, evictor PodEvictor, health HealthChecker,
+	prePuller ImagePrePuller, setter ImageSetter,
+	annotator DeploymentAnnotator, recorder EventRecorder,
+	verifier ImageSignatureVerifier, rollout rolloutPolicy,
+	credsGetter RepositoryCredentialsGetter,
+	credsProvider RepositoryCredentialsProvider,
+) (
+	f *Figwasp, e error,
+) {
+	var (
+		deploymentObject appsV1.Deployment
+		reference        figwasp.ImageReference
+		refLister        ImageReferenceLister
+	)
+
+	refLister, e = newRefLister(config, namespace, deployment, timeout)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// before any registry is contacted, or credentials presented, for them
+	e = checkAllowed(allowList, deployment, refLister.ListImageReferences())
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f = &Figwasp{
+		allowList:   allowList,
+		annotator:   annotator,
+		credentials: make(map[string]repositoryCredentials),
+		evictor:     evictor,
+		health:      health,
+		images:      make(map[string]containerImage),
+		observed:    make(map[string]imageObservation),
+		pool:        pool,
+		prePuller:   prePuller,
+		recorder:    recorder,
+		references:  refLister.ListImageReferences(),
+		refLister:   refLister,
+		restarter:   restarter,
+		rollout:     rollout,
+		rollouts:    rollouts,
+		setter:      setter,
+		verifier:    verifier,
+
+		deployment: deployment,
+		timeout:    timeout,
+	}
+
+	deploymentObject, e = getDeployment(config, namespace, deployment, timeout)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addTagPolicy(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// images of the pod template, which the pods may not yet run
+	e = checkAllowed(allowList, deployment, f.listImageReferences())
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addObservations(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addRestartSchedule(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addCooldown(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addRestartMethod(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.addRestartOrder(deploymentObject)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	for _, reference = range f.references {
+		e = f.addRetriever(reference, credsGetter, credsProvider)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	for _, reference = range f.listImageReferences() {
+		e = f.addRetriever(reference, credsGetter, credsProvider)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (f *Figwasp) RunConcurrently(
+	errorChannel chan<- error, waitGroup *sync.WaitGroup,
+) {
+	errorChannel <- f.Run()
+
+	waitGroup.Done()
+
+	return
+}
+
+func (f *Figwasp) Run() (e error) {
+	var (
+		reference figwasp.ImageReference
+
+		changed  []imageDigestComparison
+		complete bool
+		deferred bool
+		images   map[string]string
+		skipped  bool
+		results  chan imageDigestComparison
+		result   imageDigestComparison
+		selected []imageDigestComparison
+	)
+
+	if f.policy != nil || f.timestamps != nil {
+		images, e = f.selectImages()
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	// a new tag rolls the Deployment out in place of a restart
+	if len(images) > 0 {
+		f.pending = true
+
+		if f.verifier != nil || f.rollout.minimumImageAge > 0 {
+			selected, e = f.resolveImages(images)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+		}
+
+		if f.rollout.minimumImageAge > 0 {
+			images, selected, e = f.filterImagesByAge(images, selected)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+		}
+
+		// a deferral is dropped if no tag is old enough to roll out
+		if len(images) == 0 {
+			e = f.recordDeferral(nil)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			return
+		}
+
+		skipped, e = f.skipNotAllowed(images)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if skipped {
+			return
+		}
+
+		skipped, e = f.skipUnverified(selected)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if skipped {
+			return
+		}
+
+		skipped, e = f.skipDuringCooldown(
+			listImages(images),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if skipped {
+			return
+		}
+
+		deferred, e = f.deferOutsideSchedule(
+			listImages(images),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if deferred {
+			return
+		}
+
+		skipped, e = f.skipUnhealthy(
+			listImages(images),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if skipped {
+			return
+		}
+
+		e = f.prePullImages(
+			listImages(images),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = f.rollouts.Rollout(f.deployment,
+			func() error {
+				return f.setImages(images)
+			},
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		f.pending, f.rolledOut = false, true
+
+		e = f.recordSkippedRestarts(0)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = f.recordObservations(
+			make(map[string]imageObservation),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = f.recordDeferral(nil)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	results = make(chan imageDigestComparison,
+		len(f.references),
+	) // buffered so that no sender is left blocked after an early return
+
+	for _, reference = range f.references {
+		go f.retrieveAndCompareImageDigest(reference, results)
+	}
+
+	for range f.references {
+		result = <-results
+
+		if result.e != nil {
+			e = errors.Trace(result.e)
+
+			return
+		}
+
+		if result.changed {
+			changed = append(changed, result)
+		}
+	}
+
+	// until rolled out, even if too new, skipped or deferred below
+	f.pending = len(changed) > 0
+
+	if f.rollout.minimumImageAge > 0 {
+		changed, e = f.filterByImageAge(changed)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	// a deferral is dropped if nothing is left to roll out
+	if len(changed) == 0 {
+		e = f.recordDeferral(nil)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	skipped, e = f.skipUnverified(changed)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if skipped {
+		return
+	}
+
+	skipped, e = f.skipDuringCooldown(
+		listComparedImages(changed),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if skipped {
+		return
+	}
+
+	deferred, e = f.deferOutsideSchedule(
+		listComparedImages(changed),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if deferred {
+		return
+	}
+
+	skipped, e = f.skipUnhealthy(
+		listComparedImages(changed),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if skipped {
+		return
+	}
+
+	e = f.prePullImages(
+		listComparedImages(changed),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if f.evict {
+		e = f.rollouts.Rollout(f.deployment,
+			func() (e error) {
+				complete, e = f.evictStalePods(changed)
+
+				return
+			},
+		)
+
+	} else {
+		complete = true
+
+		e = f.rollouts.Rollout(f.deployment, f.rolloutRestart)
+	}
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// stale pods left by a refused eviction are evicted by the next run
+	if !complete {
+		return
+	}
+
+	f.pending, f.rolledOut = false, true
+
+	e = f.recordSkippedRestarts(0)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.recordObservations(
+		make(map[string]imageObservation),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = f.recordDeferral(nil)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) skipNotAllowed(images map[string]string) (
+	skipped bool, e error,
+) {
+	const (
+		reason = "ImageNotAllowed"
+	)
+
+	var (
+		cancel     context.CancelFunc
+		ctx        context.Context
+		image      string
+		notAllowed error
+		reference  figwasp.ImageReference
+		references []figwasp.ImageReference
+	)
+
+	for _, image = range images {
+		reference, e = figwasp.NewImageReferenceFromString(image)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		references = append(references, reference)
+	}
+
+	// tags selected are held to the same restrictions as those deployed
+	notAllowed = checkAllowed(f.allowList, f.deployment, references)
+	if notAllowed == nil {
+		return
+	}
+
+	skipped = true
+
+	log.Printf("deployment %s: update skipped, %s", f.deployment, notAllowed)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.recorder.RecordWarning(f.deployment,
+		reason,
+		notAllowed.Error(),
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) skipUnverified(changed []imageDigestComparison) (
+	skipped bool, e error,
+) {
+	const (
+		reason         = "ImageSignatureNotVerified"
+		messageFormat  = "restart skipped: %s"
+		failureFormat  = "%s@%s: %s"
+		failuresJoiner = "; "
+	)
+
+	var (
+		cancel     context.CancelFunc
+		comparison imageDigestComparison
+		ctx        context.Context
+		failures   []string
+		message    string
+		signatures []figwasp.ImageSignature
+	)
+
+	if f.verifier == nil {
+		return
+	}
+
+	// a restart would pull every new image, so each must be verified
+	for _, comparison = range changed {
+		ctx, cancel = context.WithTimeout(background, f.timeout)
+
+		signatures, e = f.pool.RetrieveImageSignatures(comparison.reference,
+			comparison.digest,
+			f.credentials[comparison.reference.RepositoryName],
+			ctx,
+		)
+
+		cancel()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = f.verifier.VerifyImageSignatures(comparison.digest, signatures)
+		if e != nil {
+			failures = append(failures,
+				fmt.Sprintf(failureFormat,
+					comparison.reference.NamedAndTagged,
+					comparison.digest,
+					e,
+				),
+			)
+
+			e = nil
+		}
+	}
+
+	if len(failures) == 0 {
+		return
+	}
+
+	skipped = true
+
+	message = fmt.Sprintf(messageFormat,
+		strings.Join(failures, failuresJoiner),
+	)
+
+	log.Printf("deployment %s: %s", f.deployment, message)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.recorder.RecordWarning(f.deployment, reason, message, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) skipDuringCooldown(images []string) (
+	skipped bool, e error,
+) {
+	var (
+		until time.Time
+	)
+
+	until = f.restartedAt.Add(f.cooldown)
+
+	if f.cooldown == 0 || !time.Now().Before(until) {
+		return
+	}
+
+	skipped = true
+
+	e = f.recordSkippedRestarts(f.skippedRestarts + 1)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// skipped rather than deferred, as the images may change again
+	log.Printf("deployment %s: restart skipped in cooldown until %s, "+
+		"%d skipped since last restart, for %s",
+		f.deployment,
+		until.Format(time.RFC3339),
+		f.skippedRestarts,
+		strings.Join(images, ", "),
+	)
+
+	return
+}
+
+func (f *Figwasp) skipUnhealthy(images []string) (skipped bool, e error) {
+	var (
+		cancel  context.CancelFunc
+		ctx     context.Context
+		problem string
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	problem, e = f.health.CheckHealth(f.deployment, ctx)
+	if errors.IsForbidden(e) {
+		// the replicas are available; the budgets are left unchecked
+		log.Printf("deployment %s: disruption budgets not checked, "+
+			"missing permission to list poddisruptionbudgets, %s",
+			f.deployment,
+			e,
+		)
+
+		e = nil
+	}
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if problem == "" {
+		return
+	}
+
+	skipped = true
+
+	// so as not to disrupt a workload already degraded; checked again next run
+	log.Printf("deployment %s: restart skipped as unhealthy, %s, for %s",
+		f.deployment,
+		problem,
+		strings.Join(images, ", "),
+	)
+
+	return
+}
+
+func (f *Figwasp) recordSkippedRestarts(skippedRestarts int) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+		value  string
+	)
+
+	if skippedRestarts == f.skippedRestarts {
+		return
+	}
+
+	if skippedRestarts > 0 {
+		value = strconv.Itoa(skippedRestarts)
+	} // else the annotation is removed
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.annotator.Annotate(f.deployment,
+		map[string]string{
+			skippedAnnotationKey: value,
+		},
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f.skippedRestarts = skippedRestarts
+
+	return
+}
+
+func (f *Figwasp) deferOutsideSchedule(images []string) (
+	deferred bool, e error,
+) {
+	var (
+		deferral restartDeferral
+	)
+
+	if f.schedule == nil || f.schedule.Allows(time.Now()) {
+		return
+	}
+
+	deferred = true
+
+	deferral = restartDeferral{
+		Since:  time.Now().UTC().Truncate(time.Second),
+		Images: images,
+	}
+
+	// deferred since the first detection outside the schedule
+	if f.deferral != nil {
+		deferral.Since = f.deferral.Since
+	}
+
+	e = f.recordDeferral(&deferral)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) recordDeferral(deferral *restartDeferral) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+		value  []byte
+	)
+
+	if reflect.DeepEqual(deferral, f.deferral) {
+		return
+	}
+
+	if deferral != nil {
+		value, e = json.Marshal(deferral)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	} // else the annotation is removed
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.annotator.Annotate(f.deployment,
+		map[string]string{
+			deferralAnnotationKey: string(value),
+		},
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f.deferral = deferral
+
+	return
+}
+
+func (f *Figwasp) filterByImageAge(changed []imageDigestComparison) (
+	aged []imageDigestComparison, e error,
+) {
+	var (
+		age        time.Duration
+		comparison imageDigestComparison
+		observed   map[string]imageObservation
+	)
+
+	observed = make(map[string]imageObservation)
+
+	// so that images pushed in quick succession are rolled out once,
+	// when the last has been in the repository for long enough
+	for _, comparison = range changed {
+		switch f.rollout.imageAgeSource {
+		case imageAgeSourceObserved:
+			age, observed[comparison.reference.NamedAndTagged] =
+				f.observedAge(comparison)
+
+		default:
+			age, e = f.createdAge(comparison.reference)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+		}
+
+		if age >= f.rollout.minimumImageAge {
+			aged = append(aged, comparison)
+		}
+	}
+
+	// observations of superseded digests are dropped,
+	// and the rest once rolled out
+	e = f.recordObservations(observed)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) filterImagesByAge(
+	images map[string]string, selected []imageDigestComparison,
+) (
+	aged map[string]string, agedSelected []imageDigestComparison, e error,
+) {
+	var (
+		comparison imageDigestComparison
+		found      bool
+		image      string
+		name       string
+		old        map[string]bool // by image reference
+		reference  figwasp.ImageReference
+	)
+
+	agedSelected, e = f.filterByImageAge(selected)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	old = make(map[string]bool)
+
+	for _, comparison = range agedSelected {
+		old[comparison.reference.NamedAndTagged] = true
+	}
+
+	aged = make(map[string]string)
+
+	// containers whose tags are too new keep their images until a later run
+	for name, image = range images {
+		reference, e = figwasp.NewImageReferenceFromString(image)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		_, found = old[reference.NamedAndTagged]
+		if found {
+			aged[name] = image
+		}
+	}
+
+	return
+}
+
+func (f *Figwasp) observedAge(comparison imageDigestComparison) (
+	age time.Duration, observation imageObservation,
+) {
+	var (
+		found bool
+	)
+
+	observation, found = f.observed[comparison.reference.NamedAndTagged]
+
+	if !found || observation.Digest != comparison.digest {
+		observation = imageObservation{
+			Digest:     comparison.digest,
+			ObservedAt: time.Now().UTC().Truncate(time.Second),
+		}
+	}
+
+	age = time.Since(observation.ObservedAt)
+
+	return
+}
+
+func (f *Figwasp) createdAge(reference figwasp.ImageReference) (
+	age time.Duration, e error,
+) {
+	var (
+		cancel      context.CancelFunc
+		created     time.Time
+		credentials repositoryCredentials
+		ctx         context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	credentials = f.credentials[reference.RepositoryName]
+
+	created, e = f.pool.RetrieveImageCreated(reference, credentials, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	age = time.Since(created)
+
+	return
+}
+
+func (f *Figwasp) recordObservations(observed map[string]imageObservation) (
+	e error,
+) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+		value  []byte
+	)
+
+	if reflect.DeepEqual(observed, f.observed) {
+		return
+	}
+
+	if len(observed) > 0 {
+		value, e = json.Marshal(observed)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	} // else the annotation is removed
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.annotator.Annotate(f.deployment,
+		map[string]string{
+			observedAnnotationKey: string(value),
+		},
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f.observed = observed
+
+	return
+}
+
+func (f *Figwasp) selectImages() (images map[string]string, e error) {
+	var (
+		cancel      context.CancelFunc
+		container   containerImage
+		credentials repositoryCredentials
+		ctx         context.Context
+		name        string
+		tag         string
+		tags        []string
+	)
+
+	images = make(map[string]string)
+
+	for name, container = range f.images {
+		ctx, cancel = context.WithTimeout(background, f.timeout)
+
+		credentials = f.credentials[container.reference.RepositoryName]
+
+		tags, e = f.pool.ListRepositoryTags(container.reference,
+			credentials,
+			ctx,
+		)
+
+		cancel()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if f.timestamps != nil {
+			tag, e = f.selectTagByTimestamp(container.reference,
+				credentials,
+				tags,
+			)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+		} else {
+			tag = f.policy.SelectTag(container.reference.Tag, tags)
+		}
+
+		if tag == container.reference.Tag {
+			continue
+		}
+
+		// the image is otherwise left as written, e.g. "busybox:1.35.0"
+		images[name] = strings.TrimSuffix(container.image,
+			":"+container.reference.Tag,
+		) + ":" + tag
+	}
+
+	return
+}
+
+func (f *Figwasp) selectTagByTimestamp(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+	tags []string,
+) (
+	selectedTag string, e error,
+) {
+	const (
+		imageFormat = "%s:%s"
+	)
+
+	var (
+		cancel    context.CancelFunc
+		created   map[string]time.Time // by tag
+		ctx       context.Context
+		filtered  []string
+		tag       string
+		tagged    figwasp.ImageReference
+		timestamp time.Time
+	)
+
+	selectedTag = reference.Tag
+
+	// no configurations are retrieved for images outside the pattern
+	if len(f.timestamps.FilterTags([]string{reference.Tag})) == 0 {
+		return
+	}
+
+	created = make(map[string]time.Time)
+
+	// every tag matching is inspected; configurations are retrieved only
+	// for digests not seen before, as the times are cached by digest
+	filtered = f.timestamps.FilterTags(tags)
+
+	// the current tag is included as it may no longer be listed
+	for _, tag = range append([]string{reference.Tag}, filtered...) {
+		tagged, e = figwasp.NewImageReferenceFromString(
+			fmt.Sprintf(imageFormat, reference.RepositoryName, tag),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(background, f.timeout)
+
+		timestamp, e = f.pool.RetrieveImageCreated(tagged, credentials, ctx)
+
+		cancel()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		created[tag] = timestamp
+	}
+
+	selectedTag = f.timestamps.SelectTag(reference.Tag, created)
+
+	return
+}
+
+func (f *Figwasp) resolveImages(images map[string]string) (
+	resolved []imageDigestComparison, e error,
+) {
+	var (
+		cancel    context.CancelFunc
+		ctx       context.Context
+		digest    string
+		image     string
+		reference figwasp.ImageReference
+	)
+
+	// the digests of the tags selected, to be verified as any other
+	for _, image = range images {
+		reference, e = figwasp.NewImageReferenceFromString(image)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(background, f.timeout)
+
+		digest, e = f.pool.RetrieveImageDigest(reference,
+			f.credentials[reference.RepositoryName],
+			ctx,
+		)
+
+		cancel()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		resolved = append(resolved,
+			imageDigestComparison{
+				reference: reference,
+				digest:    digest,
+				changed:   true,
+			},
+		)
+	}
+
+	return
+}
+
+func (f *Figwasp) setImages(images map[string]string) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.setter.SetImages(f.deployment, images, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) retrieveAndCompareImageDigest(
+	reference figwasp.ImageReference, results chan<- imageDigestComparison,
+) {
+	var (
+		cancel      context.CancelFunc
+		credentials repositoryCredentials
+		ctx         context.Context
+		digest      string
+		e           error
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	credentials = f.credentials[reference.RepositoryName]
+
+	digest, e = f.pool.RetrieveImageDigest(reference, credentials, ctx)
+	if e != nil {
+		results <- imageDigestComparison{
+			e: errors.Trace(e),
+		}
+
+		return
+	}
+
+	results <- imageDigestComparison{
+		reference: reference,
+		digest:    digest,
+		changed:   digest != reference.ImageDigest,
+	}
+
+	return
+}
+
+func (f *Figwasp) rolloutRestart() (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.restarter.RolloutRestart(f.deployment, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) prePullImages(images []string) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+		pulled bool
+	)
+
+	if !f.prePull {
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(background, f.rollout.prePullTimeout)
+
+	defer cancel()
+
+	pulled, e = f.prePuller.PrePullImages(f.deployment, images, ctx)
+
+	// new pods pull whatever images the pre-pull did not,
+	// e.g. where its pods are not admitted
+	if e != nil {
+		log.Printf("deployment %s: pre-pull failed, "+
+			"rolling out regardless, for %s, %s",
+			f.deployment,
+			strings.Join(images, ", "),
+			e,
+		)
+
+		e = nil
+
+		return
+	}
+
+	if !pulled {
+		log.Printf("deployment %s: pre-pull timed out after %s, "+
+			"rolling out regardless, for %s",
+			f.deployment,
+			f.rollout.prePullTimeout,
+			strings.Join(images, ", "),
+		)
+	}
+
+	return
+}
+
+func (f *Figwasp) evictStalePods(changed []imageDigestComparison) (
+	complete bool, e error,
+) {
+	var (
+		cancel     context.CancelFunc
+		comparison imageDigestComparison
+		ctx        context.Context
+		evicted    map[string]bool
+		pod        string
+		refused    bool
+	)
+
+	evicted = make(map[string]bool)
+
+	// one at a time, each subject to the Deployment's PodDisruptionBudgets,
+	// and each once its predecessor has been replaced, pulling the image afresh
+	for _, comparison = range changed {
+		for _, pod = range f.refLister.ListPodNames(comparison.reference) {
+			if evicted[pod] {
+				continue
+			}
+
+			ctx, cancel = context.WithTimeout(background, f.timeout)
+
+			refused, e = f.evictor.EvictPod(pod, ctx)
+
+			cancel()
+
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			if refused {
+				log.Printf("deployment %s: eviction of pod %s refused "+
+					"by disruption budget; stale pods left for the next run",
+					f.deployment,
+					pod,
+				)
+
+				return
+			}
+
+			evicted[pod] = true
+
+			ctx, cancel = context.WithTimeout(background, f.rollouts.timeout)
+
+			e = f.evictor.WaitForEviction(pod, ctx)
+
+			cancel()
+
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			e = f.rollouts.WaitForRollout(f.deployment)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+		}
+	}
+
+	complete = true
+
+	// as a restart, for the cooldown; not before, so that stale pods
+	// left by a refused eviction are evicted by the next run
+	if len(evicted) > 0 {
+		e = f.recordEviction(
+			time.Now(),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (f *Figwasp) recordEviction(evictedAt time.Time) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, f.timeout)
+
+	defer cancel()
+
+	e = f.annotator.Annotate(f.deployment,
+		map[string]string{
+			evictedAnnotationKey: evictedAt.UTC().Format(time.RFC3339),
+		},
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	f.restartedAt = evictedAt
+
+	return
+}
+
+func (f *Figwasp) addTagPolicy(deployment appsV1.Deployment) (e error) {
+	var (
+		container v1.Container
+		found     bool
+		reference figwasp.ImageReference
+	)
+
+	found, e = f.newTagPolicy(deployment.Annotations)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if !found {
+		return
+	}
+
+	for _, container = range append(
+		deployment.Spec.Template.Spec.InitContainers,
+		deployment.Spec.Template.Spec.Containers...,
+	) {
+		reference, e = figwasp.NewImageReferenceFromString(container.Image)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
 
-	deployment string
-	timeout    time.Duration
+		if reference.ImageDigest != "" {
+			continue // pinned by digest
+		}
+
+		f.images[container.Name] = containerImage{
+			image:     container.Image,
+			reference: reference,
+		}
+	}
+
+	return
 }
 
-func NewFigwasp(
-	config *rest.Config, namespace, deployment string, timeout time.Duration,
-	credsGetter RepositoryCredentialsGetter, restarter RolloutRestarter,
-	retrievers map[string]ImageDigestRetriever,
-) (
-	f *Figwasp, e error,
+func (f *Figwasp) addObservations(deployment appsV1.Deployment) (e error) {
+	var (
+		found bool
+		value string
+	)
+
+	value, found = deployment.Annotations[observedAnnotationKey]
+	if !found {
+		return
+	}
+
+	e = json.Unmarshal([]byte(value), &f.observed)
+	if e != nil {
+		e = errors.NewNotValid(e,
+			fmt.Sprintf("annotation %s", observedAnnotationKey),
+		)
+
+		return
+	}
+
+	return
+}
+
+func (f *Figwasp) addRestartSchedule(deployment appsV1.Deployment) (
+	e error,
 ) {
+	const (
+		windowsAnnotationKey   = "figwasp/maintenanceWindows"
+		blackoutsAnnotationKey = "figwasp/blackouts"
+		timeZoneAnnotationKey  = "figwasp/timeZone"
+	)
+
 	var (
-		reference figwasp.ImageReference
-		refLister ImageReferenceLister
+		blackouts      string
+		blackoutsFound bool
+		deferral       string
+		deferralFound  bool
+		timeZone       string
+		windows        string
+		windowsFound   bool
 	)
 
-	refLister, e = newRefLister(config, namespace, deployment, timeout)
+	deferral, deferralFound = deployment.Annotations[deferralAnnotationKey]
+	if deferralFound {
+		f.deferral = new(restartDeferral)
+
+		e = json.Unmarshal([]byte(deferral), f.deferral)
+		if e != nil {
+			e = errors.NewNotValid(e,
+				fmt.Sprintf("annotation %s", deferralAnnotationKey),
+			)
+
+			return
+		}
+	}
+
+	windows, windowsFound = deployment.Annotations[windowsAnnotationKey]
+
+	blackouts, blackoutsFound = deployment.Annotations[blackoutsAnnotationKey]
+
+	timeZone = deployment.Annotations[timeZoneAnnotationKey]
+
+	if !windowsFound && !blackoutsFound {
+		return
+	}
+
+	f.schedule, e = figwasp.NewRestartSchedule(windows, blackouts, timeZone)
 	if e != nil {
-		e = errors.Trace(e)
+		e = errors.Annotatef(e, "annotations %s, %s and %s",
+			windowsAnnotationKey,
+			blackoutsAnnotationKey,
+			timeZoneAnnotationKey,
+		)
 
 		return
 	}
 
-	f = &Figwasp{
-		credsGetter: credsGetter,
-		references:  refLister.ListImageReferences(),
-		restarter:   restarter,
-		retrievers:  retrievers,
+	return
+}
 
-		deployment: deployment,
-		timeout:    timeout,
+func (f *Figwasp) addCooldown(deployment appsV1.Deployment) (e error) {
+	const (
+		cooldownAnnotationKey    = "figwasp/cooldown"
+		restartedAtAnnotationKey = "figwasp/restartedAt" // on the template
+	)
+
+	var (
+		cooldown    string
+		evictedAt   time.Time
+		found       bool
+		restartedAt string
+		skipped     string
+	)
+
+	skipped, found = deployment.Annotations[skippedAnnotationKey]
+	if found {
+		f.skippedRestarts, e = strconv.Atoi(skipped)
+		if e != nil {
+			e = errors.NewNotValid(e,
+				fmt.Sprintf("annotation %s", skippedAnnotationKey),
+			)
+
+			return
+		}
 	}
 
-	for _, reference = range f.references {
-		e = f.addRetriever(reference.RepositoryAddress)
+	cooldown, found = deployment.Annotations[cooldownAnnotationKey]
+	if !found {
+		return
+	}
+
+	// e.g. "30m", the minimum interval between restarts by Figwasp
+	f.cooldown, e = time.ParseDuration(cooldown)
+	if e != nil || f.cooldown < 0 {
+		e = errors.NotValidf("annotation %s %q",
+			cooldownAnnotationKey,
+			cooldown,
+		)
+
+		return
+	}
+
+	restartedAt, found =
+		deployment.Spec.Template.Annotations[restartedAtAnnotationKey]
+	if found {
+		f.restartedAt, e = time.Parse(time.RFC3339, restartedAt)
 		if e != nil {
-			e = errors.Trace(e)
+			e = errors.NewNotValid(e,
+				fmt.Sprintf("annotation %s", restartedAtAnnotationKey),
+			)
+
+			return
+		}
+	} // else never restarted by Figwasp
+
+	// stale pods evicted leave the pod template as it was
+	restartedAt, found = deployment.Annotations[evictedAnnotationKey]
+	if found {
+		evictedAt, e = time.Parse(time.RFC3339, restartedAt)
+		if e != nil {
+			e = errors.NewNotValid(e,
+				fmt.Sprintf("annotation %s", evictedAnnotationKey),
+			)
 
 			return
 		}
+
+		if evictedAt.After(f.restartedAt) {
+			f.restartedAt = evictedAt
+		}
 	}
 
 	return
 }
 
-func (f *Figwasp) RunConcurrently(
-	errorChannel chan<- error, waitGroup *sync.WaitGroup,
-) {
-	errorChannel <- f.Run()
+func (f *Figwasp) addRestartMethod(deployment appsV1.Deployment) (e error) {
+	const (
+		evictAnnotationKey   = "figwasp/evictStalePods"
+		prePullAnnotationKey = "figwasp/prePull"
+	)
 
-	waitGroup.Done()
+	var (
+		evict   string
+		found   bool
+		prePull string
+	)
+
+	evict, found = deployment.Annotations[evictAnnotationKey]
+	if found {
+		f.evict, e = strconv.ParseBool(evict)
+		if e != nil {
+			e = errors.NotValidf("annotation %s %q", evictAnnotationKey, evict)
+
+			return
+		}
+	}
+
+	prePull, found = deployment.Annotations[prePullAnnotationKey]
+	if found {
+		f.prePull, e = strconv.ParseBool(prePull)
+		if e != nil {
+			e = errors.NotValidf("annotation %s %q",
+				prePullAnnotationKey,
+				prePull,
+			)
+
+			return
+		}
+	}
 
 	return
 }
 
-func (f *Figwasp) Run() (e error) {
+func (f *Figwasp) addRestartOrder(deployment appsV1.Deployment) (e error) {
+	const (
+		waveAnnotationKey   = "figwasp/wave"
+		afterAnnotationKey  = "figwasp/after"
+		afterSeparator      = ","
+		canaryAnnotationKey = "figwasp/canary"
+	)
+
 	var (
-		reference figwasp.ImageReference
+		after  string
+		canary string
+		found  bool
+		name   string
+		wave   string
+	)
+
+	canary, found = deployment.Annotations[canaryAnnotationKey]
+	if found {
+		f.canary, e = strconv.ParseBool(canary)
+		if e != nil {
+			e = errors.NotValidf("annotation %s %q",
+				canaryAnnotationKey,
+				canary,
+			)
+
+			return
+		}
+	}
 
-		waitGroup *sync.WaitGroup
+	wave, found = deployment.Annotations[waveAnnotationKey]
+	if found {
+		f.wave, e = strconv.Atoi(wave)
+		if e != nil {
+			e = errors.NotValidf("annotation %s %q", waveAnnotationKey, wave)
 
-		failure chan error
-		nothing chan struct{}
-		trigger chan struct{}
-	)
+			return
+		}
+	}
 
-	failure = make(chan error)
-	nothing = make(chan struct{})
-	trigger = make(chan struct{})
+	// e.g. "backend" or "backend, database"
+	after = deployment.Annotations[afterAnnotationKey]
 
-	waitGroup = new(sync.WaitGroup)
+	for _, name = range strings.Split(after, afterSeparator) {
+		name = strings.TrimSpace(name)
 
-	waitGroup.Add(
-		len(f.references),
+		if name != "" {
+			f.after = append(f.after, name)
+		}
+	}
+
+	return
+}
+
+func (f *Figwasp) newTagPolicy(annotations map[string]string) (
+	found bool, e error,
+) {
+	const (
+		semverAnnotationKey     = "figwasp/semver"
+		tagPolicyAnnotationKey  = "figwasp/tagPolicy"
+		tagPatternAnnotationKey = "figwasp/tagPattern"
+
+		tagPolicyAlphabetical = "alphabetical"
+		tagPolicyNumerical    = "numerical"
+		tagPolicyTimestamp    = "timestamp"
 	)
 
-	for _, reference = range f.references {
-		go f.retrieveAndCompareImageDigest(reference,
-			waitGroup,
-			trigger,
-			failure,
+	var (
+		constraint   string
+		pattern      string
+		patternFound bool
+		policy       string
+		policyFound  bool
+		semverFound  bool
+	)
+
+	constraint, semverFound = annotations[semverAnnotationKey]
+
+	policy, policyFound = annotations[tagPolicyAnnotationKey]
+
+	pattern, patternFound = annotations[tagPatternAnnotationKey]
+
+	switch {
+	case semverFound && (policyFound || patternFound):
+		e = errors.NotValidf("annotation %s with %s or %s",
+			semverAnnotationKey,
+			tagPolicyAnnotationKey,
+			tagPatternAnnotationKey,
 		)
-	}
 
-	go wait(waitGroup, nothing)
+		return
 
-	select {
-	case <-trigger:
-		f.rolloutRestart()
+	case patternFound && !policyFound:
+		e = errors.NotValidf("annotation %s without %s",
+			tagPatternAnnotationKey,
+			tagPolicyAnnotationKey,
+		)
 
-	case e = <-failure:
 		return
 
-	case <-nothing:
+	case semverFound:
+		f.policy, e = figwasp.NewSemverTagPolicy(constraint)
+		if e != nil {
+			e = errors.Annotatef(e, "annotation %s", semverAnnotationKey)
+
+			return
+		}
+
+	case policyFound:
+		switch policy {
+		case tagPolicyAlphabetical:
+			f.policy, e = figwasp.NewAlphabeticalTagPolicy(pattern)
+
+		case tagPolicyNumerical:
+			f.policy, e = figwasp.NewNumericalTagPolicy(pattern)
+
+		case tagPolicyTimestamp:
+			f.timestamps, e = figwasp.NewTimestampTagPolicy(pattern)
+
+		default:
+			e = errors.NotValidf("annotation %s %q",
+				tagPolicyAnnotationKey,
+				policy,
+			)
+
+			return
+		}
+
+		if e != nil {
+			e = errors.Annotatef(e, "annotation %s", tagPatternAnnotationKey)
+
+			return
+		}
+
+	default:
 		return
 	}
 
+	found = true
+
 	return
 }
 
-func (f *Figwasp) addRetriever(repositoryAddress string) (e error) {
+func (f *Figwasp) usesAnyImage(images map[string]bool) bool {
 	var (
-		found     bool
-		retriever ImageDigestRetriever
+		reference figwasp.ImageReference
 	)
 
-	_, found = f.retrievers[repositoryAddress]
-	if found {
-		return
+	for _, reference = range append(f.references,
+		f.listImageReferences()...,
+	) {
+		if images[reference.NamedAndTagged] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Figwasp) listImageReferences() (references []figwasp.ImageReference) {
+	var (
+		container containerImage
+	)
+
+	for _, container = range f.images {
+		references = append(references, container.reference)
 	}
 
-	retriever, e = figwasp.NewImageDigestRetriever(
-		figwasp.WithBasicAuthentication(
-			f.credsGetter.GetRepositoryCredentials(repositoryAddress),
-		),
+	return
+}
+
+func (f *Figwasp) addRetriever(
+	reference figwasp.ImageReference,
+	credsGetter RepositoryCredentialsGetter,
+	credsProvider RepositoryCredentialsProvider,
+) (
+	e error,
+) {
+	var (
+		credentials repositoryCredentials
+		found       bool
 	)
+
+	credentials, found = f.credentials[reference.RepositoryName]
+
+	if !found {
+		credentials.username, credentials.password =
+			credsGetter.GetRepositoryCredentials(reference.RepositoryName)
+
+		credentials.identityToken, credentials.registryToken =
+			credsGetter.GetRepositoryTokens(reference.RepositoryName)
+
+		if credentials == (repositoryCredentials{}) && credsProvider != nil {
+			credentials, e = provideCreds(credsProvider,
+				reference.RepositoryName,
+				f.timeout,
+			)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+		}
+
+		f.credentials[reference.RepositoryName] = credentials
+	}
+
+	e = f.pool.AddRetriever(reference, credentials)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
-	f.retrievers[repositoryAddress] = retriever
-
 	return
 }
 
-func (f *Figwasp) retrieveAndCompareImageDigest(
-	reference figwasp.ImageReference, waitGroup *sync.WaitGroup,
-	trigger chan<- struct{}, failure chan<- error,
+func getDeployment(
+	config *rest.Config, namespace, deployment string, timeout time.Duration,
+) (
+	deploymentObject appsV1.Deployment, e error,
 ) {
 	var (
+		cancel context.CancelFunc
 		ctx    context.Context
-		digest string
-		e      error
+		getter DeploymentGetter
 	)
 
-	ctx, _ = context.WithTimeout(background, f.timeout)
-
-	digest, e = f.retrievers[reference.RepositoryAddress].RetrieveImageDigest(
-		reference.NamedAndTagged,
-		ctx,
-	)
+	getter, e = figwasp.NewDeploymentGetter(config, namespace)
 	if e != nil {
-		failure <- errors.Trace(e)
+		e = errors.Trace(e)
 
 		return
 	}
 
-	if digest != reference.ImageDigest {
-		close(trigger)
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
+
+	deploymentObject, e = getter.GetDeployment(deployment, ctx)
+	if e != nil {
+		e = errors.Trace(e)
 
 		return
 	}
 
-	waitGroup.Done()
-
 	return
 }
 
-func (f *Figwasp) rolloutRestart() (e error) {
+func checkAllowed(
+	allowList ImageAllowList, deployment string,
+	references []figwasp.ImageReference,
+) (
+	e error,
+) {
 	var (
-		ctx context.Context
+		notAllowed []string
+		reference  figwasp.ImageReference
 	)
 
-	ctx, _ = context.WithTimeout(background, f.timeout)
+	for _, reference = range references {
+		if !allowList.AllowsImage(reference) {
+			notAllowed = append(notAllowed, reference.NamedAndTagged)
+		}
+	}
 
-	e = f.restarter.RolloutRestart(f.deployment, ctx)
-	if e != nil {
-		e = errors.Trace(e)
+	if len(notAllowed) > 0 {
+		e = errors.Forbiddenf("images %s of deployment %s",
+			strings.Join(notAllowed, ", "),
+			deployment,
+		)
 
 		return
 	}
@@ -195,12 +1959,45 @@ func (f *Figwasp) rolloutRestart() (e error) {
 	return
 }
 
+func listImages(images map[string]string) (list []string) {
+	var (
+		image string
+	)
+
+	for _, image = range images {
+		list = append(list, image)
+	}
+
+	sort.Strings(list)
+
+	return
+}
+
+func listComparedImages(comparisons []imageDigestComparison) (
+	list []string,
+) {
+	var (
+		comparison imageDigestComparison
+	)
+
+	for _, comparison = range comparisons {
+		list = append(list,
+			comparison.reference.NamedAndTagged+"@"+comparison.digest,
+		)
+	}
+
+	sort.Strings(list)
+
+	return
+}
+
 func newRefLister(
 	config *rest.Config, namespace, deployment string, timeout time.Duration,
 ) (
 	refLister ImageReferenceLister, e error,
 ) {
 	var (
+		cancel    context.CancelFunc
 		ctx       context.Context
 		podList   []v1.Pod
 		podLister PodLister
@@ -213,7 +2010,9 @@ func newRefLister(
 		return
 	}
 
-	ctx, _ = context.WithTimeout(background, timeout)
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
 
 	podList, e = podLister.ListPods(deployment, ctx)
 	if e != nil {
@@ -232,10 +2031,64 @@ func newRefLister(
 	return
 }
 
-func wait(waitGroup *sync.WaitGroup, nothing chan<- struct{}) {
-	waitGroup.Wait()
+func provideCreds(
+	credsProvider RepositoryCredentialsProvider, repositoryName string,
+	timeout time.Duration,
+) (
+	credentials repositoryCredentials, e error,
+) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, timeout)
+
+	defer cancel()
+
+	credentials.username, credentials.password, e =
+		credsProvider.ProvideRepositoryCredentials(repositoryName, ctx)
+	if e != nil {
+		e = errors.Trace(e)
 
-	close(nothing)
+		return
+	}
 
 	return
 }
+
+type repositoryCredentials struct {
+	username string
+	password string
+
+	identityToken string
+	registryToken string
+}
+
+type containerImage struct {
+	image     string // as in the pod template
+	reference figwasp.ImageReference
+}
+
+type imageDigestComparison struct {
+	reference figwasp.ImageReference
+	digest    string
+	changed   bool
+	e         error
+}
+
+type restartDeferral struct {
+	Since  time.Time `json:"since"`
+	Images []string  `json:"images"` // as they would be rolled out
+}
+
+type imageObservation struct {
+	Digest     string    `json:"digest"`
+	ObservedAt time.Time `json:"observedAt"`
+}
+
+type rolloutPolicy struct {
+	minimumImageAge time.Duration
+	imageAgeSource  string
+	prePullTimeout  time.Duration
+}
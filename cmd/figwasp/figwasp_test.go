@@ -0,0 +1,870 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/figwasp/figwasp/pkg/figwasp"
+)
+
+const (
+	testDeployment = "figwasp"
+	testTimeout    = time.Second
+
+	testContainer     = "app"
+	testImageDeployed = "registry.test/app:1.0.0"
+	testImageSelected = "registry.test/app:2.0.0"
+	testTagDeployed   = "1.0.0"
+	testTagSelected   = "2.0.0"
+)
+
+func TestFigwaspRunHoldsBackTagsNewerThanMinimumImageAge(t *testing.T) {
+	const (
+		minimumImageAge = time.Hour
+	)
+
+	type testCase struct {
+		source  string
+		created time.Time
+		set     bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		f      *Figwasp
+		name   string
+		setter *fakeImageSetter
+		test   testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"a tag created recently is held back": {
+			source:  imageAgeSourceCreated,
+			created: time.Now(),
+		},
+		"a tag created long enough ago is set": {
+			source:  imageAgeSourceCreated,
+			created: time.Now().Add(-2 * minimumImageAge),
+			set:     true,
+		},
+		"a tag first observed now is held back": {
+			source:  imageAgeSourceObserved,
+			created: time.Now().Add(-2 * minimumImageAge),
+		},
+	}
+
+	for name, test = range testCases {
+		f = newFakeFigwasp(t, testDeployment, testTagSelected, test.created,
+			rolloutPolicy{
+				minimumImageAge: minimumImageAge,
+				imageAgeSource:  test.source,
+			},
+		)
+
+		e = f.Run()
+		if e != nil {
+			t.Error(e)
+		}
+
+		setter = f.setter.(*fakeImageSetter)
+
+		if test.set {
+			assert.Equal(t,
+				map[string]string{testContainer: testImageSelected},
+				setter.images,
+				name,
+			)
+
+			assert.False(t, f.pending, name)
+
+		} else {
+			assert.Nil(t, setter.images, name)
+
+			assert.True(t, f.pending, name)
+		}
+
+		if test.source == imageAgeSourceObserved {
+			assert.Contains(t,
+				f.annotator.(*fakeDeploymentAnnotator).
+					annotations[observedAnnotationKey],
+				testImageSelected,
+				name,
+			)
+		}
+	}
+}
+
+func TestFigwaspAddCooldown(t *testing.T) {
+	const (
+		restartedAt = "2026-10-19T12:00:00Z"
+	)
+
+	type testCase struct {
+		annotations         map[string]string // of the deployment
+		templateAnnotations map[string]string
+		cooldown            time.Duration
+		restartedAt         string
+		skippedRestarts     int
+		invalid             bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		deployment appsV1.Deployment
+		f          *Figwasp
+		name       string
+		test       testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"no cooldown": {},
+		"never restarted": {
+			annotations: map[string]string{
+				"figwasp/cooldown": "30m",
+			},
+			cooldown: 30 * time.Minute,
+		},
+		"restarted": {
+			annotations: map[string]string{
+				"figwasp/cooldown":        "30m",
+				"figwasp/skippedRestarts": "2",
+			},
+			templateAnnotations: map[string]string{
+				"figwasp/restartedAt": restartedAt,
+			},
+			cooldown:        30 * time.Minute,
+			restartedAt:     restartedAt,
+			skippedRestarts: 2,
+		},
+		"invalid cooldown": {
+			annotations: map[string]string{
+				"figwasp/cooldown": "half an hour",
+			},
+			invalid: true,
+		},
+		"negative cooldown": {
+			annotations: map[string]string{
+				"figwasp/cooldown": "-30m",
+			},
+			invalid: true,
+		},
+		"invalid restart time": {
+			annotations: map[string]string{
+				"figwasp/cooldown": "30m",
+			},
+			templateAnnotations: map[string]string{
+				"figwasp/restartedAt": "yesterday",
+			},
+			invalid: true,
+		},
+		"evicted since restarted": {
+			annotations: map[string]string{
+				"figwasp/cooldown":  "30m",
+				"figwasp/evictedAt": "2026-10-19T12:10:00Z",
+			},
+			templateAnnotations: map[string]string{
+				"figwasp/restartedAt": restartedAt,
+			},
+			cooldown:    30 * time.Minute,
+			restartedAt: "2026-10-19T12:10:00Z",
+		},
+		"evicted before restarted": {
+			annotations: map[string]string{
+				"figwasp/cooldown":  "30m",
+				"figwasp/evictedAt": "2026-10-19T11:50:00Z",
+			},
+			templateAnnotations: map[string]string{
+				"figwasp/restartedAt": restartedAt,
+			},
+			cooldown:    30 * time.Minute,
+			restartedAt: restartedAt,
+		},
+		"invalid eviction time": {
+			annotations: map[string]string{
+				"figwasp/cooldown":  "30m",
+				"figwasp/evictedAt": "yesterday",
+			},
+			invalid: true,
+		},
+		"invalid skipped count": {
+			annotations: map[string]string{
+				"figwasp/skippedRestarts": "two",
+			},
+			invalid: true,
+		},
+	}
+
+	for name, test = range testCases {
+		deployment = appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{
+				Annotations: test.annotations,
+			},
+		}
+
+		deployment.Spec.Template.Annotations = test.templateAnnotations
+
+		f = &Figwasp{}
+
+		e = f.addCooldown(deployment)
+
+		if test.invalid {
+			assert.True(t, errors.IsNotValid(e), name)
+
+			continue
+		}
+
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t, test.cooldown, f.cooldown, name)
+
+		assert.Equal(t, test.skippedRestarts, f.skippedRestarts, name)
+
+		if test.restartedAt != "" {
+			assert.Equal(t,
+				test.restartedAt,
+				f.restartedAt.Format(time.RFC3339),
+				name,
+			)
+
+		} else {
+			assert.True(t, f.restartedAt.IsZero(), name)
+		}
+	}
+}
+
+func TestFigwaspSkipDuringCooldown(t *testing.T) {
+	const (
+		cooldown = 30 * time.Minute
+		image    = "registry.test/app:1.0.0"
+	)
+
+	type testCase struct {
+		cooldown        time.Duration
+		restartedAgo    time.Duration
+		skippedRestarts int
+		skipped         bool
+		annotation      string // of skipped restarts, "" if left alone
+	}
+
+	var (
+		testCases map[string]testCase
+
+		annotator *fakeDeploymentAnnotator
+		f         *Figwasp
+		name      string
+		skipped   bool
+		test      testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"no cooldown": {
+			restartedAgo: time.Minute,
+		},
+		"a restart inside the window is skipped and counted": {
+			cooldown:     cooldown,
+			restartedAgo: time.Minute,
+			skipped:      true,
+			annotation:   "1",
+		},
+		"skipped restarts accumulate": {
+			cooldown:        cooldown,
+			restartedAgo:    time.Minute,
+			skippedRestarts: 2,
+			skipped:         true,
+			annotation:      "3",
+		},
+		"a restart after the window goes ahead": {
+			cooldown:        cooldown,
+			restartedAgo:    cooldown + time.Minute,
+			skippedRestarts: 2,
+		},
+	}
+
+	for name, test = range testCases {
+		annotator = newFakeDeploymentAnnotator()
+
+		f = &Figwasp{
+			annotator:       annotator,
+			cooldown:        test.cooldown,
+			restartedAt:     time.Now().Add(-test.restartedAgo),
+			skippedRestarts: test.skippedRestarts,
+
+			deployment: testDeployment,
+			timeout:    testTimeout,
+		}
+
+		skipped, e = f.skipDuringCooldown([]string{image})
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t, test.skipped, skipped, name)
+
+		assert.Equal(t,
+			test.annotation,
+			annotator.annotations[skippedAnnotationKey],
+			name,
+		)
+	}
+
+	// the count is reset once the deployment is rolled out
+	annotator = newFakeDeploymentAnnotator()
+
+	f = &Figwasp{
+		annotator:       annotator,
+		skippedRestarts: 3,
+
+		deployment: testDeployment,
+		timeout:    testTimeout,
+	}
+
+	e = f.recordSkippedRestarts(0)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t, 0, f.skippedRestarts)
+
+	assert.Contains(t, annotator.annotations, skippedAnnotationKey)
+
+	assert.Equal(t, "", annotator.annotations[skippedAnnotationKey])
+}
+
+func TestFigwaspEvictStalePodsRecordsEviction(t *testing.T) {
+	type testCase struct {
+		refused  map[string]bool // by pod name
+		evicted  []string
+		complete bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		annotator *fakeDeploymentAnnotator
+		complete  bool
+		evictor   *fakePodEvictor
+		f         *Figwasp
+		name      string
+		reference figwasp.ImageReference
+		rollouts  *RolloutLimiter
+		test      testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"stale pods evicted are recorded as a restart": {
+			evicted:  []string{"pod-0", "pod-1"},
+			complete: true,
+		},
+		"evictions refused are not recorded": {
+			refused: map[string]bool{"pod-1": true},
+			evicted: []string{"pod-0"},
+		},
+	}
+
+	reference, e = figwasp.NewImageReferenceFromString(testImageDeployed)
+	if e != nil {
+		t.Error(e)
+	}
+
+	rollouts, e = NewRolloutLimiter(0, &fakeRolloutWaiter{}, testTimeout)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for name, test = range testCases {
+		annotator = newFakeDeploymentAnnotator()
+
+		evictor = &fakePodEvictor{
+			refused: test.refused,
+		}
+
+		f = &Figwasp{
+			annotator: annotator,
+			evictor:   evictor,
+			refLister: &fakeImageReferenceLister{
+				pods: []string{"pod-0", "pod-1"},
+			},
+			rollouts: rollouts,
+
+			deployment: testDeployment,
+			timeout:    testTimeout,
+		}
+
+		complete, e = f.evictStalePods(
+			[]imageDigestComparison{
+				{reference: reference, changed: true},
+			},
+		)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t, test.complete, complete, name)
+
+		assert.Equal(t, test.evicted, evictor.evicted, name)
+
+		if test.complete {
+			assert.Contains(t, annotator.annotations, evictedAnnotationKey, name)
+
+			assert.False(t, f.restartedAt.IsZero(), name)
+
+		} else {
+			assert.NotContains(t,
+				annotator.annotations,
+				evictedAnnotationKey,
+				name,
+			)
+		}
+	}
+}
+
+func TestFigwaspSkipUnhealthy(t *testing.T) {
+	type testCase struct {
+		health  *fakeHealthChecker
+		skipped bool
+		failed  bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		f       *Figwasp
+		name    string
+		skipped bool
+		test    testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"healthy": {
+			health: &fakeHealthChecker{},
+		},
+		"unhealthy": {
+			health: &fakeHealthChecker{
+				problem: "1 of 2 replicas available",
+			},
+			skipped: true,
+		},
+		"budgets not to be listed are not checked": {
+			health: &fakeHealthChecker{
+				e: errors.NewForbidden(nil, "list of PodDisruptionBudgets"),
+			},
+		},
+		"other errors fail the run": {
+			health: &fakeHealthChecker{
+				e: errors.New("connection refused"),
+			},
+			failed: true,
+		},
+	}
+
+	for name, test = range testCases {
+		f = &Figwasp{
+			health: test.health,
+
+			deployment: testDeployment,
+			timeout:    testTimeout,
+		}
+
+		skipped, e = f.skipUnhealthy([]string{testImageDeployed})
+
+		assert.Equal(t, test.failed, e != nil, name)
+
+		assert.Equal(t, test.skipped, skipped, name)
+	}
+}
+
+func TestFigwaspPrePullImages(t *testing.T) {
+	type testCase struct {
+		prePuller *fakeImagePrePuller
+	}
+
+	var (
+		testCases map[string]testCase
+
+		f    *Figwasp
+		name string
+		test testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"pulled": {
+			prePuller: &fakeImagePrePuller{pulled: true},
+		},
+		"not pulled in time": {
+			prePuller: &fakeImagePrePuller{},
+		},
+		"pods not admitted": {
+			prePuller: &fakeImagePrePuller{
+				e: errors.Forbiddenf("pods violating PodSecurity"),
+			},
+		},
+	}
+
+	// the rollout goes ahead, new pods pulling what was not pre-pulled
+	for name, test = range testCases {
+		f = &Figwasp{
+			prePuller: test.prePuller,
+			prePull:   true,
+			rollout: rolloutPolicy{
+				prePullTimeout: testTimeout,
+			},
+
+			deployment: testDeployment,
+			timeout:    testTimeout,
+		}
+
+		e = f.prePullImages([]string{testImageSelected})
+
+		assert.NoError(t, e, name)
+	}
+}
+
+// newFakeFigwasp is of a deployment running testImageDeployed, whose
+// tag policy selects tag, and whose images were created at created
+func newFakeFigwasp(
+	t *testing.T, deployment, tag string, created time.Time,
+	rollout rolloutPolicy,
+) (
+	f *Figwasp,
+) {
+	var (
+		reference figwasp.ImageReference
+		rollouts  *RolloutLimiter
+
+		e error
+	)
+
+	// as deployed, so that its digest is unchanged
+	reference, e = figwasp.NewImageReferenceFromCanonicalString(
+		testImageDeployed + "@" + digest.FromString(testImageDeployed).String(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	rollouts, e = NewRolloutLimiter(0, &fakeRolloutWaiter{}, testTimeout)
+	if e != nil {
+		t.Error(e)
+	}
+
+	f = &Figwasp{
+		allowList:   &fakeImageAllowList{},
+		annotator:   newFakeDeploymentAnnotator(),
+		credentials: make(map[string]repositoryCredentials),
+		health:      &fakeHealthChecker{},
+		images: map[string]containerImage{
+			testContainer: {
+				image:     testImageDeployed,
+				reference: reference,
+			},
+		},
+		observed: make(map[string]imageObservation),
+		policy:   &fakeTagPolicy{tag: tag},
+		pool: newFakePool(t,
+			&fakeImageDigestRetriever{
+				tags:    []string{testTagDeployed, testTagSelected},
+				created: created,
+			},
+			reference,
+		),
+		recorder:   &fakeEventRecorder{},
+		references: []figwasp.ImageReference{reference},
+		rollout:    rollout,
+		rollouts:   rollouts,
+		setter:     &fakeImageSetter{},
+
+		deployment: deployment,
+		timeout:    testTimeout,
+	}
+
+	return
+}
+
+func newFakePool(
+	t *testing.T, retriever *fakeImageDigestRetriever,
+	references ...figwasp.ImageReference,
+) (
+	pool *ImageDigestRetrieverPool,
+) {
+	var (
+		reference figwasp.ImageReference
+
+		e error
+	)
+
+	pool, e = NewImageDigestRetrieverPool(&fakeImageDigestCache{}, 1,
+		func(figwasp.ImageReference, repositoryCredentials) (
+			ImageDigestRetriever, error,
+		) {
+			return retriever, nil
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for _, reference = range references {
+		e = pool.AddRetriever(reference, repositoryCredentials{})
+		if e != nil {
+			t.Error(e)
+		}
+	}
+
+	return
+}
+
+type fakeDeploymentAnnotator struct {
+	annotations map[string]string // of the deployment; "" once removed
+	mutex       *sync.Mutex
+}
+
+func newFakeDeploymentAnnotator() *fakeDeploymentAnnotator {
+	return &fakeDeploymentAnnotator{
+		annotations: make(map[string]string),
+		mutex:       new(sync.Mutex),
+	}
+}
+
+func (a *fakeDeploymentAnnotator) Annotate(
+	_ string, annotations map[string]string, _ context.Context,
+) (
+	e error,
+) {
+	var (
+		key   string
+		value string
+	)
+
+	a.mutex.Lock()
+
+	defer a.mutex.Unlock()
+
+	for key, value = range annotations {
+		a.annotations[key] = value
+	}
+
+	return
+}
+
+type fakeEventRecorder struct {
+	reasons []string
+}
+
+func (r *fakeEventRecorder) RecordWarning(
+	_, reason, _ string, _ context.Context,
+) (
+	e error,
+) {
+	r.reasons = append(r.reasons, reason)
+
+	return
+}
+
+type fakeHealthChecker struct {
+	problem string
+	e       error
+}
+
+func (c *fakeHealthChecker) CheckHealth(string, context.Context) (
+	string, error,
+) {
+	return c.problem, c.e
+}
+
+type fakeImageAllowList struct{}
+
+func (l *fakeImageAllowList) AllowsImage(figwasp.ImageReference) bool {
+	return true
+}
+
+type fakeImageDigestCache struct{}
+
+func (c *fakeImageDigestCache) RetrieveImageDigest(
+	key string, ctx context.Context,
+	retrieve func(string, context.Context) (string, error),
+) (
+	string, error,
+) {
+	return retrieve(key, ctx)
+}
+
+type fakeImageDigestRetriever struct {
+	tags    []string
+	created time.Time
+}
+
+func (r *fakeImageDigestRetriever) RetrieveImageDigest(
+	imageReferenceString string, _ context.Context,
+) (
+	string, error,
+) {
+	return digest.FromString(imageReferenceString).String(), nil
+}
+
+func (r *fakeImageDigestRetriever) ListRepositoryTags(string, context.Context) (
+	[]string, error,
+) {
+	return r.tags, nil
+}
+
+func (r *fakeImageDigestRetriever) RetrieveImageCreated(
+	string, context.Context,
+) (
+	time.Time, error,
+) {
+	return r.created, nil
+}
+
+func (r *fakeImageDigestRetriever) RetrieveImageSignatures(
+	string, string, context.Context,
+) (
+	[]figwasp.ImageSignature, error,
+) {
+	return nil, nil
+}
+
+type fakeImagePrePuller struct {
+	pulled bool
+	e      error
+}
+
+func (p *fakeImagePrePuller) PrePullImages(
+	string, []string, context.Context,
+) (
+	bool, error,
+) {
+	return p.pulled, p.e
+}
+
+type fakeImageSetter struct {
+	images map[string]string // by container name, as last set
+}
+
+func (s *fakeImageSetter) SetImages(
+	_ string, images map[string]string, _ context.Context,
+) (
+	e error,
+) {
+	s.images = images
+
+	return
+}
+
+type fakeImageReferenceLister struct {
+	pods []string
+}
+
+func (l *fakeImageReferenceLister) ListImageReferences() (
+	references []figwasp.ImageReference,
+) {
+	return
+}
+
+func (l *fakeImageReferenceLister) ListPodNames(figwasp.ImageReference) (
+	pods []string,
+) {
+	return l.pods
+}
+
+type fakePodEvictor struct {
+	refused map[string]bool // by pod name
+	evicted []string
+}
+
+func (v *fakePodEvictor) EvictPod(pod string, _ context.Context) (
+	refused bool, e error,
+) {
+	refused = v.refused[pod]
+
+	if !refused {
+		v.evicted = append(v.evicted, pod)
+	}
+
+	return
+}
+
+func (v *fakePodEvictor) WaitForEviction(string, context.Context) (e error) {
+	return
+}
+
+type fakeRolloutWaiter struct {
+	mutex    sync.Mutex
+	failures map[string]error // by deployment name
+	watched  map[string]time.Duration
+}
+
+func (w *fakeRolloutWaiter) WaitForRollout(
+	deployment string, _ context.Context,
+) (
+	e error,
+) {
+	w.mutex.Lock()
+
+	defer w.mutex.Unlock()
+
+	e = w.failures[deployment]
+
+	return
+}
+
+func (w *fakeRolloutWaiter) WatchRollout(
+	deployment string, period time.Duration, _ context.Context,
+) (
+	e error,
+) {
+	w.mutex.Lock()
+
+	defer w.mutex.Unlock()
+
+	if w.watched == nil {
+		w.watched = make(map[string]time.Duration)
+	}
+
+	w.watched[deployment] = period
+
+	e = w.failures[deployment]
+
+	return
+}
+
+type fakeTagPolicy struct {
+	tag string
+}
+
+func (p *fakeTagPolicy) SelectTag(current string, tags []string) string {
+	var (
+		tag string
+	)
+
+	for _, tag = range tags {
+		if tag == p.tag {
+			return tag
+		}
+	}
+
+	return current
+}
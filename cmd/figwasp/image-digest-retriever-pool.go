@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/figwasp/figwasp/pkg/figwasp"
+)
+
+type ImageDigestRetrieverPool struct {
+	cache        ImageDigestCache
+	created      map[string]time.Time // by digest, as images do not change
+	mutex        *sync.Mutex
+	newRetriever func(figwasp.ImageReference, repositoryCredentials) (
+		ImageDigestRetriever, error,
+	)
+	retrievers map[imageDigestRetrieverKey]ImageDigestRetriever
+	workers    chan struct{}
+}
+
+func NewImageDigestRetrieverPool(
+	cache ImageDigestCache, nWorkers int,
+	newRetriever func(figwasp.ImageReference, repositoryCredentials) (
+		ImageDigestRetriever, error,
+	),
+) (
+	p *ImageDigestRetrieverPool, e error,
+) {
+	if nWorkers < 1 {
+		e = errors.NotValidf("number of workers %d", nWorkers)
+
+		return
+	}
+
+	p = &ImageDigestRetrieverPool{
+		cache:        cache,
+		created:      make(map[string]time.Time),
+		mutex:        new(sync.Mutex),
+		newRetriever: newRetriever, // called once per repository and credentials
+		retrievers:   make(map[imageDigestRetrieverKey]ImageDigestRetriever),
+		workers:      make(chan struct{}, nWorkers),
+	}
+
+	return
+}
+
+func (p *ImageDigestRetrieverPool) AddRetriever(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+) (
+	e error,
+) {
+	var (
+		found     bool
+		key       imageDigestRetrieverKey
+		retriever ImageDigestRetriever
+	)
+
+	key = imageDigestRetrieverKey{
+		repositoryName: reference.RepositoryName,
+		credentials:    credentials,
+	}
+
+	p.mutex.Lock()
+
+	defer p.mutex.Unlock()
+
+	_, found = p.retrievers[key]
+	if found {
+		return
+	}
+
+	retriever, e = p.newRetriever(reference, credentials)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	p.retrievers[key] = retriever
+
+	return
+}
+
+func (p *ImageDigestRetrieverPool) RetrieveImageDigest(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+	ctx context.Context,
+) (
+	digest string, e error,
+) {
+	var (
+		found     bool
+		key       imageDigestRetrieverKey
+		retriever ImageDigestRetriever
+	)
+
+	key = imageDigestRetrieverKey{
+		repositoryName: reference.RepositoryName,
+		credentials:    credentials,
+	}
+
+	p.mutex.Lock()
+
+	retriever, found = p.retrievers[key]
+
+	p.mutex.Unlock()
+
+	if !found {
+		e = errors.NotFoundf("retriever for %s", reference.RepositoryName)
+
+		return
+	}
+
+	// a digest retrieved with one workload's credentials
+	// is not shared with workloads presenting different ones
+	digest, e = p.cache.RetrieveImageDigest(key.cacheKey(reference), ctx,
+		func(_ string, ctx context.Context) (digest string, e error) {
+			select {
+			case p.workers <- struct{}{}:
+				defer func() { <-p.workers }()
+
+			case <-ctx.Done():
+				e = errors.Trace(
+					ctx.Err(),
+				)
+
+				return
+			}
+
+			digest, e = retriever.RetrieveImageDigest(
+				reference.NamedAndTagged,
+				ctx,
+			)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			return
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (p *ImageDigestRetrieverPool) ListRepositoryTags(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+	ctx context.Context,
+) (
+	tags []string, e error,
+) {
+	var (
+		found     bool
+		key       imageDigestRetrieverKey
+		retriever ImageDigestRetriever
+	)
+
+	key = imageDigestRetrieverKey{
+		repositoryName: reference.RepositoryName,
+		credentials:    credentials,
+	}
+
+	p.mutex.Lock()
+
+	retriever, found = p.retrievers[key]
+
+	p.mutex.Unlock()
+
+	if !found {
+		e = errors.NotFoundf("retriever for %s", reference.RepositoryName)
+
+		return
+	}
+
+	// tags are listed afresh each run, not cached as digests may be
+	select {
+	case p.workers <- struct{}{}:
+		defer func() { <-p.workers }()
+
+	case <-ctx.Done():
+		e = errors.Trace(
+			ctx.Err(),
+		)
+
+		return
+	}
+
+	tags, e = retriever.ListRepositoryTags(reference.RepositoryName, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (p *ImageDigestRetrieverPool) RetrieveImageCreated(
+	reference figwasp.ImageReference, credentials repositoryCredentials,
+	ctx context.Context,
+) (
+	created time.Time, e error,
+) {
+	const (
+		digestSeparator = "@"
+	)
+
+	var (
+		digest    string
+		found     bool
+		key       imageDigestRetrieverKey
+		retriever ImageDigestRetriever
+	)
+
+	// the tag is resolved to its digest as other tags are, and the digest
+	// to its creation time only once, as that of an image does not change
+	digest, e = p.RetrieveImageDigest(reference, credentials, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	p.mutex.Lock()
+
+	created, found = p.created[digest]
+
+	p.mutex.Unlock()
+
+	if found {
+		return
+	}
+
+	key = imageDigestRetrieverKey{
+		repositoryName: reference.RepositoryName,
+		credentials:    credentials,
+	}
+
+	p.mutex.Lock()
+
+	retriever, found = p.retrievers[key]
+
+	p.mutex.Unlock()
+
+	if !found {
+		e = errors.NotFoundf("retriever for %s", reference.RepositoryName)
+
+		return
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		defer func() { <-p.workers }()
+
+	case <-ctx.Done():
+		e = errors.Trace(
+			ctx.Err(),
+		)
+
+		return
+	}
+
+	created, e = retriever.RetrieveImageCreated(
+		reference.RepositoryName+digestSeparator+digest,
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	p.mutex.Lock()
+
+	p.created[digest] = created
+
+	p.mutex.Unlock()
+
+	return
+}
+
+type imageDigestRetrieverKey struct {
+	repositoryName string
+	credentials    repositoryCredentials
+}
+
+func (k imageDigestRetrieverKey) cacheKey(reference figwasp.ImageReference) (
+	s string,
+) {
+	const (
+		separator = "\x00"
+	)
+
+	s = strings.Join(
+		[]string{
+			reference.NamedAndTagged,
+			k.credentials.username,
+			k.credentials.password,
+			k.credentials.identityToken,
+			k.credentials.registryToken,
+		},
+		separator,
+	)
+
+	return
+}
+
+func (p *ImageDigestRetrieverPool) RetrieveImageSignatures(
+	reference figwasp.ImageReference, digest string,
+	credentials repositoryCredentials, ctx context.Context,
+) (
+	signatures []figwasp.ImageSignature, e error,
+) {
+	var (
+		found     bool
+		key       imageDigestRetrieverKey
+		retriever ImageDigestRetriever
+	)
+
+	key = imageDigestRetrieverKey{
+		repositoryName: reference.RepositoryName,
+		credentials:    credentials,
+	}
+
+	p.mutex.Lock()
+
+	retriever, found = p.retrievers[key]
+
+	p.mutex.Unlock()
+
+	if !found {
+		e = errors.NotFoundf("retriever for %s", reference.RepositoryName)
+
+		return
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		defer func() { <-p.workers }()
+
+	case <-ctx.Done():
+		e = errors.Trace(
+			ctx.Err(),
+		)
+
+		return
+	}
+
+	signatures, e = retriever.RetrieveImageSignatures(reference.RepositoryName,
+		digest,
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
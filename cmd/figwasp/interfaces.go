@@ -2,36 +2,132 @@ package main
 
 import (
 	"context"
+	"net/url"
+	"time"
 
+	appsV1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
 
 	"github.com/figwasp/figwasp/pkg/figwasp"
 )
 
+type DeploymentAnnotator interface {
+	Annotate(string, map[string]string, context.Context) error
+}
+
+type DeploymentGetter interface {
+	GetDeployment(string, context.Context) (appsV1.Deployment, error)
+}
+
 type DeploymentNameLister interface {
 	ListDeploymentNames(context.Context) ([]string, error)
 }
 
+type EventRecorder interface {
+	RecordWarning(string, string, string, context.Context) error
+}
+
+type HealthChecker interface {
+	CheckHealth(string, context.Context) (string, error)
+}
+
+type ImageAllowList interface {
+	AllowsImage(figwasp.ImageReference) bool
+}
+
+type ImageDigestCache interface {
+	RetrieveImageDigest(
+		string,
+		context.Context,
+		func(string, context.Context) (string, error),
+	) (
+		string,
+		error,
+	)
+}
+
 type ImageDigestRetriever interface {
 	RetrieveImageDigest(string, context.Context) (string, error)
+	ListRepositoryTags(string, context.Context) ([]string, error)
+	RetrieveImageCreated(string, context.Context) (time.Time, error)
+	RetrieveImageSignatures(string, string, context.Context) (
+		[]figwasp.ImageSignature, error,
+	)
+}
+
+type ImagePrePuller interface {
+	PrePullImages(string, []string, context.Context) (bool, error)
+}
+
+type ImagePullSecretLister interface {
+	ListImagePullSecrets(string, context.Context) ([]v1.Secret, error)
 }
 
 type ImageReferenceLister interface {
 	ListImageReferences() []figwasp.ImageReference
+	ListPodNames(figwasp.ImageReference) []string
+}
+
+type ImageSetter interface {
+	SetImages(string, map[string]string, context.Context) error
+}
+
+type ImageSignatureVerifier interface {
+	VerifyImageSignatures(string, []figwasp.ImageSignature) error
+}
+
+type PodEvictor interface {
+	EvictPod(string, context.Context) (bool, error)
+	WaitForEviction(string, context.Context) error
 }
 
 type PodLister interface {
 	ListPods(string, context.Context) ([]v1.Pod, error)
 }
 
+type RegistryConfiguration interface {
+	PathToCertificateDirectory() string
+	PathToRegistriesConfiguration() string
+	Proxies() map[string]*url.URL
+	Destroy() error
+}
+
+type RegistryProxy interface {
+	URL() string
+	Close() error
+}
+
+type RepositoryCredentialsProvider interface {
+	ProvideRepositoryCredentials(string, context.Context) (string, string, error)
+}
+
 type RepositoryCredentialsGetter interface {
 	GetRepositoryCredentials(string) (string, string)
+	GetRepositoryTokens(string) (string, string)
+}
+
+type RestartSchedule interface {
+	Allows(time.Time) bool
 }
 
 type RolloutRestarter interface {
 	RolloutRestart(string, context.Context) error
 }
 
-type SecretLister interface {
-	ListSecrets(context.Context) ([]v1.Secret, error)
+type RolloutWaiter interface {
+	WaitForRollout(string, context.Context) error
+	WatchRollout(string, time.Duration, context.Context) error
+}
+
+type SecretGetter interface {
+	GetSecret(string, context.Context) (v1.Secret, error)
+}
+
+type TagPolicy interface {
+	SelectTag(string, []string) string
+}
+
+type TimestampTagPolicy interface {
+	FilterTags([]string) []string
+	SelectTag(string, map[string]time.Time) string
 }
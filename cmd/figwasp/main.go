@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"time"
+	_ "time/tzdata" // for time zones of restart schedules; not in alpine
 
 	"github.com/caarlos0/env/v6"
 	"github.com/juju/errors"
@@ -13,11 +14,53 @@ import (
 type environmentVariables struct {
 	Namespace string        `env:"FIGWASP_TARGET_NAMESPACE"`
 	Timeout   time.Duration `env:"FIGWASP_CLIENT_TIMEOUT"`
+
+	CacheTTL  time.Duration `env:"FIGWASP_DIGEST_CACHE_TTL"`
+	Workers   int           `env:"FIGWASP_WORKERS"`
+	RateLimit float64       `env:"FIGWASP_REGISTRY_RATE_LIMIT"`
+	RateBurst int           `env:"FIGWASP_REGISTRY_RATE_BURST"`
+
+	RetryAttempts     int           `env:"FIGWASP_REGISTRY_RETRY_ATTEMPTS"`
+	RetryDelayInitial time.Duration `env:"FIGWASP_REGISTRY_RETRY_DELAY"`
+	RetryDelayMaximum time.Duration `env:"FIGWASP_REGISTRY_RETRY_DELAY_MAX"`
+
+	CredentialProviderConfig string `env:"FIGWASP_CREDENTIAL_PROVIDER_CONFIG"`
+	CredentialProviderBinDir string `env:"FIGWASP_CREDENTIAL_PROVIDER_BIN_DIR"`
+
+	CredentialSources []string `env:"FIGWASP_CREDENTIAL_SOURCES" envSeparator:","`
+	DockerConfigPath  string   `env:"FIGWASP_DOCKER_CONFIG_PATH"`
+	CredentialsSecret string   `env:"FIGWASP_CREDENTIALS_SECRET"`
+
+	RegistriesConfig string `env:"FIGWASP_REGISTRIES_CONFIG"`
+
+	AllowedImages       []string `env:"FIGWASP_ALLOWED_IMAGES" envSeparator:","`
+	SignaturePublicKeys []string `env:"FIGWASP_SIGNATURE_PUBLIC_KEYS" envSeparator:","`
+
+	MinimumImageAge time.Duration `env:"FIGWASP_MINIMUM_IMAGE_AGE"`
+	ImageAgeSource  string        `env:"FIGWASP_IMAGE_AGE_SOURCE"`
+
+	MaxRollouts    int           `env:"FIGWASP_MAX_CONCURRENT_ROLLOUTS"`
+	RolloutTimeout time.Duration `env:"FIGWASP_ROLLOUT_TIMEOUT"`
+	CanaryPeriod   time.Duration `env:"FIGWASP_CANARY_PERIOD"`
+	PrePullTimeout time.Duration `env:"FIGWASP_PRE_PULL_TIMEOUT"`
 }
 
 func main() {
 	const (
 		timeoutDefault = time.Second * 30
+
+		workersDefault   = 16
+		rateLimitDefault = 0 // no limit
+		rateBurstDefault = 1
+
+		retryAttemptsDefault     = 4
+		retryDelayInitialDefault = time.Second
+		retryDelayMaximumDefault = time.Second * 8
+
+		maxRolloutsDefault    = 0 // no limit
+		rolloutTimeoutDefault = time.Minute * 10
+		canaryPeriodDefault   = time.Minute * 5
+		prePullTimeoutDefault = time.Minute * 5
 	)
 
 	var (
@@ -40,6 +83,23 @@ func main() {
 	envVars = environmentVariables{
 		Namespace: v1.NamespaceDefault,
 		Timeout:   timeoutDefault,
+
+		Workers:   workersDefault,
+		RateLimit: rateLimitDefault,
+		RateBurst: rateBurstDefault,
+
+		RetryAttempts:     retryAttemptsDefault,
+		RetryDelayInitial: retryDelayInitialDefault,
+		RetryDelayMaximum: retryDelayMaximumDefault,
+
+		CredentialSources: credsOrderDefault,
+
+		ImageAgeSource: imageAgeSourceCreated,
+
+		MaxRollouts:    maxRolloutsDefault,
+		RolloutTimeout: rolloutTimeoutDefault,
+		CanaryPeriod:   canaryPeriodDefault,
+		PrePullTimeout: prePullTimeoutDefault,
 	}
 
 	e = env.Parse(&envVars)
@@ -59,6 +119,31 @@ func main() {
 	swarm, e = NewFigwaspSwarm(config,
 		envVars.Namespace,
 		envVars.Timeout,
+		WithImageDigestCacheTTL(envVars.CacheTTL),
+		WithWorkers(envVars.Workers),
+		WithRegistryRateLimit(envVars.RateLimit, envVars.RateBurst),
+		WithRegistryRetries(
+			envVars.RetryAttempts,
+			envVars.RetryDelayInitial,
+			envVars.RetryDelayMaximum,
+		),
+		WithCredentialProvider(
+			envVars.CredentialProviderConfig,
+			envVars.CredentialProviderBinDir,
+		),
+		WithCredentialSourceOrder(envVars.CredentialSources),
+		WithDockerConfigFile(envVars.DockerConfigPath),
+		WithCredentialsSecret(envVars.CredentialsSecret),
+		WithRegistryConfiguration(envVars.RegistriesConfig),
+		WithAllowedImages(envVars.AllowedImages),
+		WithSignatureVerification(envVars.SignaturePublicKeys),
+		WithMinimumImageAge(envVars.MinimumImageAge, envVars.ImageAgeSource),
+		WithMaximumConcurrentRollouts(
+			envVars.MaxRollouts,
+			envVars.RolloutTimeout,
+		),
+		WithCanaryPeriod(envVars.CanaryPeriod),
+		WithPrePullTimeout(envVars.PrePullTimeout),
 	)
 	if e != nil {
 		e = errors.Trace(e)
@@ -66,6 +151,8 @@ func main() {
 		return
 	}
 
+	defer swarm.Destroy()
+
 	e = swarm.Run()
 	if e != nil {
 		e = errors.Trace(e)
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+var (
+	proxyEnvironmentKeys = []string{
+		"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy",
+	}
+	noProxyEnvironmentKeys = []string{
+		"NO_PROXY", "no_proxy",
+	}
+)
+
+// setRegistryTransportProxy makes proxyURL the proxy of every transport that
+// takes its proxy from the environment through net/http, as those of
+// containers/image do, for the rest of the process.
+//
+// containers/image gives registry transports no other way to be proxied,
+// and net/http reads the environment only the first time it is asked,
+// so the environment is pointed at proxyURL, read, and then restored:
+// child processes and anything else reading the environment see it as it
+// was, while http.ProxyFromEnvironment, and so http.DefaultTransport,
+// answers proxyURL for every request from then on.
+//
+// It must therefore run before anything in the process asks net/http for
+// proxies from the environment; if anything has, the proxies read then
+// would stand, and an error satisfying errors.IsNotSupported is returned.
+func setRegistryTransportProxy(proxyURL string) (e error) {
+	const (
+		probeURL = "https://registry.invalid"
+	)
+
+	var (
+		found    bool
+		key      string
+		original map[string]string
+		probe    *http.Request
+		proxy    *url.URL
+		unset    []string
+		value    string
+	)
+
+	original = make(map[string]string)
+
+	defer func() {
+		for key, value = range original {
+			os.Setenv(key, value)
+		}
+
+		for _, key = range unset {
+			os.Unsetenv(key)
+		}
+	}()
+
+	for _, key = range append(proxyEnvironmentKeys, noProxyEnvironmentKeys...) {
+		value, found = os.LookupEnv(key)
+		if found {
+			original[key] = value
+
+		} else {
+			unset = append(unset, key)
+		}
+	}
+
+	for _, key = range proxyEnvironmentKeys {
+		e = os.Setenv(key, proxyURL)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	for _, key = range noProxyEnvironmentKeys {
+		e = os.Unsetenv(key)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	probe, e = http.NewRequest(http.MethodGet, probeURL, nil)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	proxy, e = http.ProxyFromEnvironment(probe)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if proxy == nil || proxy.String() != proxyURL {
+		e = errors.NotSupportedf(
+			"registry proxy once proxies have been read from the environment",
+		)
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	registryTransportProxyTestKey = "FIGWASP_TEST_REGISTRY_TRANSPORT_PROXY"
+)
+
+// net/http reads proxies from the environment once per process,
+// so each case runs in a process of its own
+func TestSetRegistryTransportProxy(t *testing.T) {
+	const (
+		testName = "TestSetRegistryTransportProxyInProcess"
+	)
+
+	var (
+		command *exec.Cmd
+		output  []byte
+		when    string
+
+		e error
+	)
+
+	for _, when = range []string{"first", "late"} {
+		command = exec.Command(os.Args[0], "-test.run=^"+testName+"$")
+
+		command.Env = append(os.Environ(),
+			registryTransportProxyTestKey+"="+when,
+		)
+
+		output, e = command.CombinedOutput()
+
+		assert.NoError(t, e, when+": "+string(output))
+	}
+}
+
+func TestSetRegistryTransportProxyInProcess(t *testing.T) {
+	const (
+		environmentProxy = "http://proxy.test:3128"
+		registryProxy    = "http://127.0.0.1:5000"
+		registryURL      = "https://registry.test/v2/"
+	)
+
+	var (
+		found   bool
+		proxy   *url.URL
+		request *http.Request
+
+		e error
+	)
+
+	if os.Getenv(registryTransportProxyTestKey) == "" {
+		t.Skip("run by TestSetRegistryTransportProxy")
+	}
+
+	os.Unsetenv("HTTP_PROXY")
+	os.Unsetenv("http_proxy")
+	os.Unsetenv("https_proxy")
+	os.Unsetenv("no_proxy")
+
+	os.Setenv("HTTPS_PROXY", environmentProxy)
+	os.Setenv("NO_PROXY", "registry.test")
+
+	request, e = http.NewRequest(http.MethodGet, registryURL, nil)
+	if e != nil {
+		t.Error(e)
+	}
+
+	if os.Getenv(registryTransportProxyTestKey) == "late" {
+		_, e = http.ProxyFromEnvironment(request)
+		if e != nil {
+			t.Error(e)
+		}
+
+		e = setRegistryTransportProxy(registryProxy)
+
+		assert.True(t, errors.IsNotSupported(e))
+
+		return
+	}
+
+	e = setRegistryTransportProxy(registryProxy)
+	if e != nil {
+		t.Error(e)
+	}
+
+	// the environment is as it was
+	assert.Equal(t, environmentProxy, os.Getenv("HTTPS_PROXY"))
+	assert.Equal(t, "registry.test", os.Getenv("NO_PROXY"))
+
+	_, found = os.LookupEnv("HTTP_PROXY")
+
+	assert.False(t, found)
+
+	// but net/http answers the registry proxy, even for hosts not to proxy
+	proxy, e = http.ProxyFromEnvironment(request)
+	if e != nil {
+		t.Error(e)
+	}
+
+	if assert.NotNil(t, proxy) {
+		assert.Equal(t, registryProxy, proxy.String())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+type repositoryCredentialsGetterChain struct {
+	getters []RepositoryCredentialsGetter // in order of precedence
+}
+
+func newRepositoryCredentialsGetterChain(
+	getters ...RepositoryCredentialsGetter,
+) (
+	c *repositoryCredentialsGetterChain,
+) {
+	c = &repositoryCredentialsGetterChain{
+		getters: getters,
+	}
+
+	return
+}
+
+func (c *repositoryCredentialsGetterChain) GetRepositoryCredentials(
+	repositoryName string,
+) (
+	username, password string,
+) {
+	var (
+		getter RepositoryCredentialsGetter
+	)
+
+	getter = c.getter(repositoryName)
+	if getter == nil {
+		return
+	}
+
+	username, password = getter.GetRepositoryCredentials(repositoryName)
+
+	return
+}
+
+func (c *repositoryCredentialsGetterChain) GetRepositoryTokens(
+	repositoryName string,
+) (
+	identityToken, registryToken string,
+) {
+	var (
+		getter RepositoryCredentialsGetter
+	)
+
+	getter = c.getter(repositoryName)
+	if getter == nil {
+		return
+	}
+
+	identityToken, registryToken = getter.GetRepositoryTokens(repositoryName)
+
+	return
+}
+
+func (c *repositoryCredentialsGetterChain) getter(repositoryName string) (
+	getter RepositoryCredentialsGetter,
+) {
+	var (
+		credentials repositoryCredentials
+	)
+
+	// the first source with any credentials for the repository answers for
+	// both credentials and tokens, so that the two are never mixed
+	for _, getter = range c.getters {
+		credentials.username, credentials.password =
+			getter.GetRepositoryCredentials(repositoryName)
+
+		credentials.identityToken, credentials.registryToken =
+			getter.GetRepositoryTokens(repositoryName)
+
+		if credentials != (repositoryCredentials{}) {
+			return
+		}
+	}
+
+	getter = nil
+
+	return
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestRepositoryCredentialsGetterChain(t *testing.T) {
+	const (
+		repositoryName  = "registry.test/figwasp"
+		repositoryOther = "registry.test/other"
+	)
+
+	type testCase struct {
+		getters     []RepositoryCredentialsGetter
+		credentials repositoryCredentials
+	}
+
+	var (
+		testCases map[string]testCase
+
+		chain       *repositoryCredentialsGetterChain
+		credentials repositoryCredentials
+		name        string
+		test        testCase
+	)
+
+	testCases = map[string]testCase{
+		"no getters give no credentials": {},
+		"getters without credentials give none": {
+			getters: []RepositoryCredentialsGetter{
+				&fakeCredsGetter{},
+				&fakeCredsGetter{repositoryName: repositoryName},
+			},
+		},
+		"the first getter with credentials wins": {
+			getters: []RepositoryCredentialsGetter{
+				&fakeCredsGetter{repositoryName: repositoryName,
+					credentials: repositoryCredentials{
+						username: "first",
+						password: "first",
+					},
+				},
+				&fakeCredsGetter{repositoryName: repositoryName,
+					credentials: repositoryCredentials{
+						username: "second",
+						password: "second",
+					},
+				},
+			},
+			credentials: repositoryCredentials{
+				username: "first",
+				password: "first",
+			},
+		},
+		"getters without credentials are passed over": {
+			getters: []RepositoryCredentialsGetter{
+				&fakeCredsGetter{repositoryName: repositoryName},
+				&fakeCredsGetter{repositoryName: repositoryOther,
+					credentials: repositoryCredentials{
+						username: "other",
+						password: "other",
+					},
+				},
+				&fakeCredsGetter{repositoryName: repositoryName,
+					credentials: repositoryCredentials{
+						username: "third",
+						password: "third",
+					},
+				},
+			},
+			credentials: repositoryCredentials{
+				username: "third",
+				password: "third",
+			},
+		},
+		"tokens and credentials are never mixed": {
+			getters: []RepositoryCredentialsGetter{
+				&fakeCredsGetter{repositoryName: repositoryName,
+					credentials: repositoryCredentials{
+						identityToken: "first",
+					},
+				},
+				&fakeCredsGetter{repositoryName: repositoryName,
+					credentials: repositoryCredentials{
+						username:      "second",
+						password:      "second",
+						registryToken: "second",
+					},
+				},
+			},
+			credentials: repositoryCredentials{
+				identityToken: "first",
+			},
+		},
+	}
+
+	for name, test = range testCases {
+		chain = newRepositoryCredentialsGetterChain(test.getters...)
+
+		credentials.username, credentials.password =
+			chain.GetRepositoryCredentials(repositoryName)
+
+		credentials.identityToken, credentials.registryToken =
+			chain.GetRepositoryTokens(repositoryName)
+
+		assert.Equal(t, test.credentials, credentials, name)
+	}
+}
+
+func TestFigwaspSwarmNewCredsGetter(t *testing.T) {
+	const (
+		apiServerHost  = "https://127.0.0.1:1" // nothing listens
+		deployment     = "figwasp"
+		namespace      = "default"
+		repositoryName = "registry.test/figwasp"
+		timeout        = time.Second
+	)
+
+	var (
+		config      *rest.Config
+		credsGetter RepositoryCredentialsGetter
+		swarm       *FigwaspSwarm
+		username    string
+
+		e error
+	)
+
+	config = &rest.Config{
+		Host: apiServerHost,
+	}
+
+	swarm = &FigwaspSwarm{
+		credsGetters: map[string]RepositoryCredentialsGetter{
+			credsSourceSecret: &fakeCredsGetter{repositoryName: repositoryName,
+				credentials: repositoryCredentials{
+					username: credsSourceSecret,
+					password: credsSourceSecret,
+				},
+			},
+		},
+	}
+
+	// sources not configured are skipped
+	swarm.credsOrder = []string{credsSourceDockerConfig, credsSourceSecret}
+
+	credsGetter, e = swarm.newCredsGetter(config, namespace, deployment, timeout)
+	if e != nil {
+		t.Error(e)
+	}
+
+	username, _ = credsGetter.GetRepositoryCredentials(repositoryName)
+
+	assert.Equal(t, credsSourceSecret, username)
+
+	// errors getting image pull secrets are passed on, not passed over
+	swarm.credsOrder = []string{credsSourcePullSecrets, credsSourceSecret}
+
+	credsGetter, e = swarm.newCredsGetter(config, namespace, deployment, timeout)
+
+	assert.Error(t, e)
+
+	assert.Nil(t, credsGetter)
+}
+
+type fakeCredsGetter struct {
+	repositoryName string
+	credentials    repositoryCredentials
+}
+
+func (g *fakeCredsGetter) GetRepositoryCredentials(repositoryName string) (
+	username, password string,
+) {
+	if repositoryName != g.repositoryName {
+		return
+	}
+
+	username, password = g.credentials.username, g.credentials.password
+
+	return
+}
+
+func (g *fakeCredsGetter) GetRepositoryTokens(repositoryName string) (
+	identityToken, registryToken string,
+) {
+	if repositoryName != g.repositoryName {
+		return
+	}
+
+	identityToken, registryToken =
+		g.credentials.identityToken, g.credentials.registryToken
+
+	return
+}
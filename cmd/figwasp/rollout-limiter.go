@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type RolloutLimiter struct {
+	slots   chan struct{} // nil: no limit
+	waiter  RolloutWaiter
+	timeout time.Duration
+}
+
+func NewRolloutLimiter(
+	nRollouts int, waiter RolloutWaiter, timeout time.Duration,
+) (
+	l *RolloutLimiter, e error,
+) {
+	if nRollouts < 0 {
+		e = errors.NotValidf("number of concurrent rollouts %d", nRollouts)
+
+		return
+	}
+
+	if timeout <= 0 {
+		e = errors.NotValidf("rollout timeout %s", timeout)
+
+		return
+	}
+
+	l = &RolloutLimiter{
+		waiter:  waiter,
+		timeout: timeout,
+	}
+
+	if nRollouts > 0 {
+		l.slots = make(chan struct{}, nRollouts)
+	}
+
+	return
+}
+
+func (l *RolloutLimiter) Rollout(deployment string, rollout func() error) (
+	e error,
+) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	if l.slots == nil {
+		e = rollout()
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	// queued until a slot is released by an earlier rollout completing
+	l.slots <- struct{}{}
+
+	defer func() { <-l.slots }()
+
+	e = rollout()
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(background, l.timeout)
+
+	defer cancel()
+
+	e = l.waiter.WaitForRollout(deployment, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (l *RolloutLimiter) WaitForRollout(deployment string) (e error) {
+	var (
+		cancel context.CancelFunc
+		ctx    context.Context
+	)
+
+	ctx, cancel = context.WithTimeout(background, l.timeout)
+
+	defer cancel()
+
+	e = l.waiter.WaitForRollout(deployment, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
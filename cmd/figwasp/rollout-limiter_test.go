@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutLimiterLimitsConcurrentRollouts(t *testing.T) {
+	const (
+		nRollouts    = 2
+		nDeployments = 6
+	)
+
+	var (
+		group   sync.WaitGroup
+		i       int
+		limiter *RolloutLimiter
+		waiter  *countingRolloutWaiter
+
+		e error
+	)
+
+	waiter = &countingRolloutWaiter{
+		mutex: new(sync.Mutex),
+		delay: 10 * time.Millisecond,
+	}
+
+	limiter, e = NewRolloutLimiter(nRollouts, waiter, testTimeout)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for i = 0; i < nDeployments; i++ {
+		group.Add(1)
+
+		go func() {
+			var (
+				e error
+			)
+
+			defer group.Done()
+
+			e = limiter.Rollout(testDeployment, waiter.start)
+			if e != nil {
+				t.Error(e)
+			}
+		}()
+	}
+
+	group.Wait()
+
+	// each holds its slot until rolled out, not merely until started
+	assert.Equal(t, nRollouts, waiter.maximum)
+
+	assert.Equal(t, 0, waiter.active)
+}
+
+func TestRolloutLimiterFreesSlotsOfFailedRollouts(t *testing.T) {
+	const (
+		timeout = 10 * time.Millisecond
+	)
+
+	type testCase struct {
+		rollout func() error
+		waiter  RolloutWaiter
+	}
+
+	var (
+		testCases map[string]testCase
+
+		done    chan error
+		limiter *RolloutLimiter
+		name    string
+		test    testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"rollout fails": {
+			rollout: func() error {
+				return errors.New("rollout failed")
+			},
+			waiter: &fakeRolloutWaiter{},
+		},
+		"rollout is not complete": {
+			rollout: func() error { return nil },
+			waiter: &fakeRolloutWaiter{
+				failures: map[string]error{
+					testDeployment: errors.New("progress deadline exceeded"),
+				},
+			},
+		},
+		"rollout times out": {
+			rollout: func() error { return nil },
+			waiter: &countingRolloutWaiter{
+				mutex: new(sync.Mutex),
+				block: true,
+			},
+		},
+	}
+
+	for name, test = range testCases {
+		limiter, e = NewRolloutLimiter(1, test.waiter, timeout)
+		if e != nil {
+			t.Error(e)
+		}
+
+		e = limiter.Rollout(testDeployment, test.rollout)
+
+		assert.Error(t, e, name)
+
+		// the only slot is free for the next rollout
+		done = make(chan error, 1)
+
+		go func() {
+			done <- limiter.Rollout(testDeployment,
+				func() error { return nil },
+			)
+		}()
+
+		select {
+		case <-done:
+
+		case <-time.After(testTimeout):
+			t.Error(name + ": slot not freed")
+		}
+	}
+}
+
+type countingRolloutWaiter struct {
+	mutex   *sync.Mutex
+	active  int // rollouts started, not yet waited for
+	maximum int
+	delay   time.Duration
+	block   bool // until the context is done
+}
+
+func (w *countingRolloutWaiter) start() (e error) {
+	w.mutex.Lock()
+
+	defer w.mutex.Unlock()
+
+	w.active++
+
+	if w.active > w.maximum {
+		w.maximum = w.active
+	}
+
+	return
+}
+
+func (w *countingRolloutWaiter) WaitForRollout(
+	_ string, ctx context.Context,
+) (
+	e error,
+) {
+	if w.block {
+		<-ctx.Done()
+
+		e = errors.Trace(
+			ctx.Err(),
+		)
+
+		return
+	}
+
+	time.Sleep(w.delay)
+
+	w.mutex.Lock()
+
+	defer w.mutex.Unlock()
+
+	w.active--
+
+	return
+}
+
+func (w *countingRolloutWaiter) WatchRollout(
+	string, time.Duration, context.Context,
+) (
+	e error,
+) {
+	return
+}
@@ -0,0 +1,471 @@
+package figwasp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	credentialProviderConfigKind   = "CredentialProviderConfig"
+	credentialProviderRequestKind  = "CredentialProviderRequest"
+	credentialProviderResponseKind = "CredentialProviderResponse"
+
+	credentialProviderCacheKeyTypeGlobal   = "Global"
+	credentialProviderCacheKeyTypeImage    = "Image"
+	credentialProviderCacheKeyTypeRegistry = "Registry"
+)
+
+var (
+	credentialProviderConfigAPIVersions = map[string]bool{
+		"kubelet.config.k8s.io/v1alpha1": true,
+		"kubelet.config.k8s.io/v1beta1":  true,
+		"kubelet.config.k8s.io/v1":       true,
+	}
+
+	credentialProviderAPIVersions = map[string]bool{
+		"credentialprovider.kubelet.k8s.io/v1alpha1": true,
+		"credentialprovider.kubelet.k8s.io/v1beta1":  true,
+		"credentialprovider.kubelet.k8s.io/v1":       true,
+	}
+)
+
+type credentialProviderGetter struct {
+	cache     map[string]credentialProviderCacheEntry
+	mutex     *sync.Mutex
+	pathToBin string
+	providers []credentialProvider
+}
+
+func NewCredentialProviderGetterFromConfigFile(
+	pathToConfig, pathToBinDir string,
+) (
+	g *credentialProviderGetter, e error,
+) {
+	var (
+		config   credentialProviderConfig
+		contents []byte
+
+		i int
+	)
+
+	contents, e = ioutil.ReadFile(pathToConfig)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = yaml.Unmarshal(contents, &config) // also accepts JSON, as kubelet does
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if config.Kind != credentialProviderConfigKind ||
+		!credentialProviderConfigAPIVersions[config.APIVersion] {
+		e = errors.NotValidf("credential provider config %s/%s",
+			config.APIVersion,
+			config.Kind,
+		)
+
+		return
+	}
+
+	for i = range config.Providers {
+		e = config.Providers[i].validate()
+		if e != nil {
+			e = errors.Annotatef(e, "provider %d", i)
+
+			return
+		}
+	}
+
+	g = &credentialProviderGetter{
+		cache:     make(map[string]credentialProviderCacheEntry),
+		mutex:     new(sync.Mutex),
+		pathToBin: pathToBinDir,
+		providers: config.Providers,
+	}
+
+	return
+}
+
+func (g *credentialProviderGetter) ProvideRepositoryCredentials(
+	repositoryName string, ctx context.Context,
+) (
+	username, password string, e error,
+) {
+	var (
+		provider credentialProvider
+		target   registryLocation
+		matches  bool
+	)
+
+	target, e = newRegistryLocation(repositoryName)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// as in kubelet, only providers whose matchImages match are executed;
+	// the first to return credentials for the repository takes precedence
+	for _, provider = range g.providers {
+		matches, e = provider.matches(target)
+		if e != nil {
+			e = errors.Annotatef(e, "provider %s", provider.Name)
+
+			return
+		}
+
+		if !matches {
+			continue
+		}
+
+		username, password, e = g.provide(provider, repositoryName, target, ctx)
+		if e != nil {
+			e = errors.Annotatef(e, "provider %s", provider.Name)
+
+			return
+		}
+
+		if username != "" || password != "" {
+			return
+		}
+	}
+
+	return
+}
+
+func (g *credentialProviderGetter) provide(
+	provider credentialProvider, repositoryName string, target registryLocation,
+	ctx context.Context,
+) (
+	username, password string, e error,
+) {
+	var (
+		entry    credentialProviderCacheEntry
+		found    bool
+		key      string
+		response credentialProviderResponse
+	)
+
+	for _, key = range []string{
+		provider.cacheKey(credentialProviderCacheKeyTypeImage, repositoryName),
+		provider.cacheKey(credentialProviderCacheKeyTypeRegistry, target.host),
+		provider.cacheKey(credentialProviderCacheKeyTypeGlobal, ""),
+	} {
+		g.mutex.Lock()
+
+		entry, found = g.cache[key]
+		if found && time.Now().After(entry.expiry) {
+			delete(g.cache, key)
+
+			found = false
+		}
+
+		g.mutex.Unlock()
+
+		if found {
+			username, password = entry.credentials(target)
+
+			return
+		}
+	}
+
+	response, e = g.exec(provider, repositoryName, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	entry, e = newCredentialProviderCacheEntry(response, provider)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	username, password = entry.credentials(target)
+
+	if entry.expiry.After(time.Now()) {
+		switch response.CacheKeyType {
+		case credentialProviderCacheKeyTypeImage:
+			key = provider.cacheKey(response.CacheKeyType, repositoryName)
+
+		case credentialProviderCacheKeyTypeRegistry:
+			key = provider.cacheKey(response.CacheKeyType, target.host)
+
+		default:
+			key = provider.cacheKey(response.CacheKeyType, "")
+		}
+
+		g.mutex.Lock()
+
+		g.cache[key] = entry
+
+		g.mutex.Unlock()
+	}
+
+	return
+}
+
+func (g *credentialProviderGetter) exec(
+	provider credentialProvider, repositoryName string, ctx context.Context,
+) (
+	response credentialProviderResponse, e error,
+) {
+	var (
+		command *exec.Cmd
+		request []byte
+		stderr  *bytes.Buffer
+		stdout  *bytes.Buffer
+
+		variable credentialProviderEnvVar
+	)
+
+	request, e = json.Marshal(
+		credentialProviderRequest{
+			APIVersion: provider.APIVersion,
+			Kind:       credentialProviderRequestKind,
+			Image:      repositoryName,
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	stderr, stdout = new(bytes.Buffer), new(bytes.Buffer)
+
+	command = exec.CommandContext(ctx,
+		filepath.Join(g.pathToBin, provider.Name),
+		provider.Args...,
+	)
+
+	command.Env = os.Environ()
+
+	for _, variable = range provider.Env {
+		command.Env = append(command.Env, variable.Name+"="+variable.Value)
+	}
+
+	command.Stdin = bytes.NewReader(request)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	e = command.Run()
+	if e != nil {
+		e = errors.Annotatef(e, "%s",
+			strings.TrimSpace(
+				stderr.String(),
+			),
+		)
+
+		return
+	}
+
+	e = json.Unmarshal(stdout.Bytes(), &response)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if response.Kind != credentialProviderResponseKind ||
+		response.APIVersion != provider.APIVersion {
+		e = errors.NotValidf("credential provider response %s/%s",
+			response.APIVersion,
+			response.Kind,
+		)
+
+		return
+	}
+
+	return
+}
+
+type credentialProviderConfig struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Providers  []credentialProvider `json:"providers"`
+}
+
+type credentialProvider struct {
+	Name                 string                     `json:"name"`
+	MatchImages          []string                   `json:"matchImages"`
+	DefaultCacheDuration *metaV1.Duration           `json:"defaultCacheDuration"`
+	APIVersion           string                     `json:"apiVersion"`
+	Args                 []string                   `json:"args"`
+	Env                  []credentialProviderEnvVar `json:"env"`
+}
+
+func (p credentialProvider) validate() (e error) {
+	switch {
+	case p.Name == "", p.Name == ".", p.Name == "..",
+		strings.ContainsRune(p.Name, os.PathSeparator):
+		e = errors.NotValidf("name %q", p.Name)
+
+	case len(p.MatchImages) == 0:
+		e = errors.NotValidf("empty matchImages")
+
+	case p.DefaultCacheDuration == nil || p.DefaultCacheDuration.Duration < 0:
+		e = errors.NotValidf("defaultCacheDuration")
+
+	case !credentialProviderAPIVersions[p.APIVersion]:
+		e = errors.NotValidf("apiVersion %q", p.APIVersion)
+	}
+
+	return
+}
+
+func (p credentialProvider) matches(target registryLocation) (
+	matches bool, e error,
+) {
+	var (
+		location   registryLocation
+		matchImage string
+	)
+
+	for _, matchImage = range p.MatchImages {
+		location, e = newRegistryLocation(matchImage)
+		if e != nil {
+			e = errors.Annotatef(e, "matchImages")
+
+			return
+		}
+
+		if location.Matches(target) {
+			matches = true
+
+			return
+		}
+	}
+
+	return
+}
+
+func (p credentialProvider) cacheKey(cacheKeyType, s string) string {
+	return p.Name + "\x00" + cacheKeyType + "\x00" + s
+}
+
+type credentialProviderEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type credentialProviderRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Image      string `json:"image"`
+}
+
+type credentialProviderResponse struct {
+	APIVersion    string                                  `json:"apiVersion"`
+	Kind          string                                  `json:"kind"`
+	CacheKeyType  string                                  `json:"cacheKeyType"`
+	CacheDuration *metaV1.Duration                        `json:"cacheDuration"`
+	Auth          map[string]credentialProviderAuthConfig `json:"auth"`
+}
+
+type credentialProviderAuthConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type credentialProviderCacheEntry struct {
+	expiry time.Time
+	index  []credentialsEntry
+}
+
+func newCredentialProviderCacheEntry(
+	response credentialProviderResponse, provider credentialProvider,
+) (
+	entry credentialProviderCacheEntry, e error,
+) {
+	var (
+		auth     credentialProviderAuthConfig
+		location registryLocation
+		key      string
+	)
+
+	switch response.CacheKeyType {
+	case credentialProviderCacheKeyTypeImage,
+		credentialProviderCacheKeyTypeRegistry,
+		credentialProviderCacheKeyTypeGlobal:
+
+	default:
+		e = errors.NotValidf("cacheKeyType %q", response.CacheKeyType)
+
+		return
+	}
+
+	if response.CacheDuration == nil {
+		entry.expiry = time.Now().Add(provider.DefaultCacheDuration.Duration)
+
+	} else {
+		entry.expiry = time.Now().Add(response.CacheDuration.Duration)
+	} // a duration of 0 disables caching
+
+	for key, auth = range response.Auth {
+		location, e = newRegistryLocation(key)
+		if e != nil {
+			e = errors.Annotatef(e, "auth for %s", key)
+
+			return
+		}
+
+		entry.index = append(entry.index,
+			credentialsEntry{
+				credentials: credentials{
+					username: auth.Username,
+					password: auth.Password,
+				},
+				location: location,
+			},
+		)
+	}
+
+	// more specific keys are matched first, as in kubelet
+	sort.Slice(entry.index,
+		func(i, j int) bool {
+			return entry.index[i].location.String() >
+				entry.index[j].location.String()
+		},
+	)
+
+	return
+}
+
+func (c credentialProviderCacheEntry) credentials(target registryLocation) (
+	username, password string,
+) {
+	var (
+		entry credentialsEntry
+	)
+
+	for _, entry = range c.index {
+		if entry.location.Matches(target) {
+			username, password = entry.username, entry.password
+
+			return
+		}
+	}
+
+	return
+}
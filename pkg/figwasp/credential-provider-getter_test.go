@@ -0,0 +1,193 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialProviderGetter(t *testing.T) {
+	const (
+		stubName       = "credential-provider-stub"
+		stubSourcePath = "../../test/cmd/credential-provider-stub"
+
+		config = `
+apiVersion: kubelet.config.k8s.io/v1
+kind: CredentialProviderConfig
+providers:
+- name: missing-binary
+  matchImages: ["broken.test"]
+  defaultCacheDuration: 1m
+  apiVersion: credentialprovider.kubelet.k8s.io/v1
+- name: ` + stubName + `
+  matchImages: ["*.registry.test", "registry.test:5000"]
+  defaultCacheDuration: 0s
+  apiVersion: credentialprovider.kubelet.k8s.io/v1
+  args: ["password"]
+  env:
+  - name: STUB_USERNAME
+    value: username
+  - name: STUB_CACHE_DURATION
+    value: 1m
+  - name: STUB_INVOCATIONS_PATH
+    value: %s
+`
+	)
+
+	var (
+		directory       string
+		pathToConfig    string
+		pathToInvoked   string
+		getter          *credentialProviderGetter
+		invoked         []byte
+		username        string
+		password        string
+		repositoryNames []string
+		repositoryName  string
+
+		e error
+	)
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	e = exec.Command("go", "build",
+		"-o", filepath.Join(directory, stubName),
+		stubSourcePath,
+	).Run()
+	if e != nil {
+		t.Error(e)
+	}
+
+	pathToConfig = filepath.Join(directory, "config.yaml")
+	pathToInvoked = filepath.Join(directory, "invocations")
+
+	e = ioutil.WriteFile(pathToConfig,
+		[]byte(
+			fmt.Sprintf(config, pathToInvoked),
+		),
+		0600,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	getter, e = NewCredentialProviderGetterFromConfigFile(pathToConfig,
+		directory,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	repositoryNames = []string{
+		"registry.test:5000/repo",
+		"registry.test:5000/another/repo", // cached for the registry
+		"mirror.registry.test/repo",
+	}
+
+	for _, repositoryName = range repositoryNames {
+		username, password, e = getter.ProvideRepositoryCredentials(
+			repositoryName,
+			context.Background(),
+		)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t, "username", username, repositoryName)
+		assert.Equal(t, "password", password, repositoryName)
+	}
+
+	invoked, e = ioutil.ReadFile(pathToInvoked)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		"registry.test:5000/repo\nmirror.registry.test/repo\n",
+		string(invoked),
+	)
+
+	// no provider is executed for images not matched by matchImages
+	username, password, e = getter.ProvideRepositoryCredentials(
+		"registry.test/repo",
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Empty(t, username)
+	assert.Empty(t, password)
+
+	_, _, e = getter.ProvideRepositoryCredentials(
+		"broken.test/repo",
+		context.Background(),
+	)
+	assert.Error(t, e)
+}
+
+func TestCredentialProviderGetterConfigValidation(t *testing.T) {
+	var (
+		testCases []string
+
+		directory    string
+		pathToConfig string
+		config       string
+
+		e error
+	)
+
+	testCases = []string{
+		`{"apiVersion":"v1","kind":"CredentialProviderConfig","providers":[]}`,
+		`{"apiVersion":"kubelet.config.k8s.io/v1","kind":"CredentialProviderConfig",` +
+			`"providers":[{"name":"../escape","matchImages":["*"],` +
+			`"defaultCacheDuration":"1m",` +
+			`"apiVersion":"credentialprovider.kubelet.k8s.io/v1"}]}`,
+		`{"apiVersion":"kubelet.config.k8s.io/v1","kind":"CredentialProviderConfig",` +
+			`"providers":[{"name":"provider","matchImages":[],` +
+			`"defaultCacheDuration":"1m",` +
+			`"apiVersion":"credentialprovider.kubelet.k8s.io/v1"}]}`,
+		`{"apiVersion":"kubelet.config.k8s.io/v1","kind":"CredentialProviderConfig",` +
+			`"providers":[{"name":"provider","matchImages":["*"],` +
+			`"apiVersion":"credentialprovider.kubelet.k8s.io/v1"}]}`,
+		`{"apiVersion":"kubelet.config.k8s.io/v1","kind":"CredentialProviderConfig",` +
+			`"providers":[{"name":"provider","matchImages":["*"],` +
+			`"defaultCacheDuration":"1m","apiVersion":"v1"}]}`,
+	}
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	pathToConfig = filepath.Join(directory, "config.json")
+
+	for _, config = range testCases {
+		e = ioutil.WriteFile(pathToConfig, []byte(config), 0600)
+		if e != nil {
+			t.Error(e)
+		}
+
+		_, e = NewCredentialProviderGetterFromConfigFile(pathToConfig,
+			directory,
+		)
+		assert.True(t,
+			errors.IsNotValid(e),
+			config,
+		)
+	}
+}
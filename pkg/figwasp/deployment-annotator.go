@@ -0,0 +1,86 @@
+package figwasp
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentAnnotator struct {
+	deployments typedAppsV1.DeploymentInterface
+}
+
+func NewDeploymentAnnotator(config *rest.Config, namespace string) (
+	a *deploymentAnnotator, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	a = &deploymentAnnotator{
+		deployments: clientset.AppsV1().Deployments(namespace),
+	}
+
+	return
+}
+
+func (a *deploymentAnnotator) Annotate(
+	deploymentName string, annotations map[string]string, ctx context.Context,
+) (
+	e error,
+) {
+	var (
+		deployment *appsV1.Deployment
+		key        string
+		value      string
+	)
+
+	deployment, e = a.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if deployment.ObjectMeta.Annotations == nil {
+		deployment.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	// on the Deployment, not its pod template, so as not to roll it out
+	for key, value = range annotations {
+		if value == "" {
+			delete(deployment.ObjectMeta.Annotations, key)
+
+			continue
+		}
+
+		deployment.ObjectMeta.Annotations[key] = value
+	}
+
+	_, e = a.deployments.Update(ctx,
+		deployment,
+		metaV1.UpdateOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
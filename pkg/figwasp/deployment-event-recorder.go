@@ -0,0 +1,108 @@
+package figwasp
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentEventRecorder struct {
+	deployments typedAppsV1.DeploymentInterface
+	events      typedCoreV1.EventInterface
+}
+
+func NewDeploymentEventRecorder(config *rest.Config, namespace string) (
+	r *deploymentEventRecorder, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	r = &deploymentEventRecorder{
+		deployments: clientset.AppsV1().Deployments(namespace),
+		events:      clientset.CoreV1().Events(namespace),
+	}
+
+	return
+}
+
+func (r *deploymentEventRecorder) RecordWarning(
+	deploymentName, reason, message string, ctx context.Context,
+) (
+	e error,
+) {
+	const (
+		apiVersion = "apps/v1"
+		component  = "figwasp"
+		kind       = "Deployment"
+	)
+
+	var (
+		deployment *appsV1.Deployment
+		now        metaV1.Time
+	)
+
+	deployment, e = r.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	now = metaV1.NewTime(
+		time.Now(),
+	)
+
+	// as shown by "kubectl describe deployment"
+	_, e = r.events.Create(ctx,
+		&coreV1.Event{
+			ObjectMeta: metaV1.ObjectMeta{
+				GenerateName: deploymentName + ".",
+				Namespace:    deployment.Namespace,
+			},
+			InvolvedObject: coreV1.ObjectReference{
+				APIVersion:      apiVersion,
+				Kind:            kind,
+				Name:            deployment.Name,
+				Namespace:       deployment.Namespace,
+				UID:             deployment.UID,
+				ResourceVersion: deployment.ResourceVersion,
+			},
+			Reason:  reason,
+			Message: message,
+			Source: coreV1.EventSource{
+				Component: component,
+			},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+			Type:           coreV1.EventTypeWarning,
+		},
+		metaV1.CreateOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,235 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestDeploymentEventRecorder(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5027
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag = "1.0.0"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-deployment-event-recorder-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+		replicas       = 1
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithReplicas(replicas),
+		deployments.WithContainerWithTCPPorts(imageName,
+			strings.ReplaceAll(
+				fmt.Sprintf(imageRefFormat,
+					repositoryAddressLocal.String(),
+					imageName,
+					tag,
+				),
+				localhost,
+				dockerHost,
+			),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		fieldSelectorFormat = "involvedObject.name=%s,reason=%s"
+		masterURL           = ""
+
+		reason  = "ImageSignatureNotVerified"
+		message = "restart skipped: signatures of image sha256:0 not verified"
+	)
+
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		events    *v1.EventList
+		recorder  *deploymentEventRecorder
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	recorder, e = NewDeploymentEventRecorder(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = recorder.RecordWarning(deploymentName,
+		reason,
+		message,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		t.Error(e)
+	}
+
+	events, e = clientset.CoreV1().Events(v1.NamespaceDefault).List(
+		context.Background(),
+		metaV1.ListOptions{
+			FieldSelector: fmt.Sprintf(fieldSelectorFormat,
+				deploymentName,
+				reason,
+			),
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	if !assert.Len(t, events.Items, 1) {
+		return
+	}
+
+	assert.Equal(t, message, events.Items[0].Message)
+	assert.Equal(t, v1.EventTypeWarning, events.Items[0].Type)
+
+	e = recorder.RecordWarning("missing",
+		reason,
+		message,
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+}
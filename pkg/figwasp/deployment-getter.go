@@ -0,0 +1,59 @@
+package figwasp
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentGetter struct {
+	deployments typedAppsV1.DeploymentInterface
+}
+
+func NewDeploymentGetter(config *rest.Config, namespace string) (
+	g *deploymentGetter, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	g = &deploymentGetter{
+		deployments: clientset.AppsV1().Deployments(namespace),
+	}
+
+	return
+}
+
+func (g *deploymentGetter) GetDeployment(name string, ctx context.Context) (
+	deployment appsV1.Deployment, e error,
+) {
+	var (
+		deploymentPointer *appsV1.Deployment
+	)
+
+	deploymentPointer, e = g.deployments.Get(ctx,
+		name,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	deployment = *deploymentPointer
+
+	return
+}
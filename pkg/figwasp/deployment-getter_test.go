@@ -0,0 +1,216 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestDeploymentGetter(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5017
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag = "1.0.0"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-deployment-getter-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+
+		annotationKey   = "figwasp/semver"
+		annotationValue = "~1.0"
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+		imageRef   string
+	)
+
+	imageRef = strings.ReplaceAll(
+		fmt.Sprintf(imageRefFormat,
+			repositoryAddressLocal.String(),
+			imageName,
+			tag,
+		),
+		localhost,
+		dockerHost,
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithContainerWithTCPPorts(imageName, imageRef),
+		deployments.WithAnnotation(annotationKey, annotationValue),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		masterURL = ""
+	)
+
+	var (
+		config *rest.Config
+		getter *deploymentGetter
+
+		got appsV1.Deployment
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	getter, e = NewDeploymentGetter(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	got, e = getter.GetDeployment(deploymentName,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		annotationValue,
+		got.Annotations[annotationKey],
+	)
+
+	if assert.Len(t, got.Spec.Template.Spec.Containers, 1) {
+		assert.Equal(t,
+			imageRef,
+			got.Spec.Template.Spec.Containers[0].Image,
+		)
+	}
+
+	_, e = getter.GetDeployment("missing",
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+}
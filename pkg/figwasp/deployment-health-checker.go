@@ -0,0 +1,125 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	policyV1 "k8s.io/api/policy/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedPolicyV1 "k8s.io/client-go/kubernetes/typed/policy/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentHealthChecker struct {
+	budgets     typedPolicyV1.PodDisruptionBudgetInterface
+	deployments typedAppsV1.DeploymentInterface
+}
+
+func NewDeploymentHealthChecker(config *rest.Config, namespace string) (
+	c *deploymentHealthChecker, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	c = &deploymentHealthChecker{
+		budgets:     clientset.PolicyV1().PodDisruptionBudgets(namespace),
+		deployments: clientset.AppsV1().Deployments(namespace),
+	}
+
+	return
+}
+
+func (c *deploymentHealthChecker) CheckHealth(
+	deploymentName string, ctx context.Context,
+) (
+	problem string, e error, // problem is "" if the deployment is healthy
+) {
+	var (
+		budget     policyV1.PodDisruptionBudget
+		budgets    *policyV1.PodDisruptionBudgetList
+		deployment *appsV1.Deployment
+		replicas   int32
+		selector   labels.Selector
+	)
+
+	deployment, e = c.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	replicas = 1
+
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	if deployment.Status.AvailableReplicas < replicas ||
+		deployment.Status.UnavailableReplicas > 0 {
+		problem = fmt.Sprintf("%d of %d replicas available",
+			deployment.Status.AvailableReplicas,
+			replicas,
+		)
+
+		return
+	}
+
+	budgets, e = c.budgets.List(ctx,
+		metaV1.ListOptions{},
+	)
+	if apiErrors.IsForbidden(e) {
+		// for the caller to report, having found the replicas available
+		e = errors.NewForbidden(e, "list of PodDisruptionBudgets")
+
+		return
+	}
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// budgets covering the pods of the deployment, whatever else they cover
+	for _, budget = range budgets.Items {
+		selector, e = metaV1.LabelSelectorAsSelector(budget.Spec.Selector)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if !selector.Matches(
+			labels.Set(deployment.Spec.Template.Labels),
+		) {
+			continue
+		}
+
+		if budget.Status.DisruptionsAllowed < 1 {
+			problem = fmt.Sprintf("no disruptions allowed by %s",
+				budget.Name,
+			)
+
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,327 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	policyV1 "k8s.io/api/policy/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clientTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestDeploymentHealthChecker(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5023
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag = "1.0.0"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-deployment-health-checker-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+		replicas       = 1
+
+		deploymentLabelKey = "app"
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithReplicas(replicas),
+		deployments.WithLabel(deploymentLabelKey, deploymentName),
+		deployments.WithContainerWithTCPPorts(imageName,
+			strings.ReplaceAll(
+				fmt.Sprintf(imageRefFormat,
+					repositoryAddressLocal.String(),
+					imageName,
+					tag,
+				),
+				localhost,
+				dockerHost,
+			),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		budgetName = "budget"
+		masterURL  = ""
+		timeout    = time.Minute * 2
+	)
+
+	var (
+		cancel    context.CancelFunc
+		checker   *deploymentHealthChecker
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		ctx       context.Context
+		problem   string
+		waiter    *deploymentRolloutWaiter
+
+		minAvailable intstr.IntOrString
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	waiter, e = NewDeploymentRolloutWaiter(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	checker, e = NewDeploymentHealthChecker(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+
+	defer cancel()
+
+	e = waiter.WaitForRollout(deploymentName, ctx)
+	if e != nil {
+		t.Error(e)
+	}
+
+	problem, e = checker.CheckHealth(deploymentName, ctx)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Empty(t, problem)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		t.Error(e)
+	}
+
+	// as many to be available as there are replicas: none may be disrupted
+	minAvailable = intstr.FromInt(replicas)
+
+	_, e = clientset.PolicyV1().PodDisruptionBudgets(v1.NamespaceDefault).Create(
+		ctx,
+		&policyV1.PodDisruptionBudget{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: budgetName,
+			},
+			Spec: policyV1.PodDisruptionBudgetSpec{
+				MinAvailable: &minAvailable,
+				Selector: &metaV1.LabelSelector{
+					MatchLabels: map[string]string{
+						deploymentLabelKey: deploymentName,
+					},
+				},
+			},
+		},
+		metaV1.CreateOptions{},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	problem, e = checker.CheckHealth(deploymentName, ctx)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Contains(t, problem, budgetName)
+
+	_, e = checker.CheckHealth("missing", ctx)
+
+	assert.Error(t, e)
+}
+
+func TestDeploymentHealthCheckerWithoutPermissionToListBudgets(t *testing.T) {
+	const (
+		deploymentName = "figwasp"
+		namespace      = "default"
+	)
+
+	var (
+		checker   *deploymentHealthChecker
+		clientset *fake.Clientset
+		problem   string
+		replicas  int32
+
+		e error
+	)
+
+	replicas = 1
+
+	clientset = fake.NewSimpleClientset(
+		&appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      deploymentName,
+				Namespace: namespace,
+			},
+			Spec: appsV1.DeploymentSpec{
+				Replicas: &replicas,
+			},
+			Status: appsV1.DeploymentStatus{
+				AvailableReplicas: replicas,
+			},
+		},
+	)
+
+	clientset.PrependReactor("list", "poddisruptionbudgets",
+		func(action clientTesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apiErrors.NewForbidden(
+				schema.GroupResource{
+					Group:    "policy",
+					Resource: "poddisruptionbudgets",
+				},
+				"",
+				fmt.Errorf("missing permission"),
+			)
+		},
+	)
+
+	checker = &deploymentHealthChecker{
+		budgets:     clientset.PolicyV1().PodDisruptionBudgets(namespace),
+		deployments: clientset.AppsV1().Deployments(namespace),
+	}
+
+	problem, e = checker.CheckHealth(deploymentName, context.Background())
+
+	assert.True(t, errors.IsForbidden(e))
+
+	assert.Empty(t, problem)
+}
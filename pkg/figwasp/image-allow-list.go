@@ -0,0 +1,78 @@
+package figwasp
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+type imageAllowList struct {
+	locations []registryLocation
+}
+
+func NewImageAllowList(locations ...string) (l *imageAllowList, e error) {
+	var (
+		location registryLocation
+		s        string
+	)
+
+	l = &imageAllowList{}
+
+	// e.g. "registry.internal:5000", "*.example.com", "docker.io/library"
+	for _, s = range locations {
+		s = strings.TrimSpace(s)
+
+		if s == "" {
+			continue
+		}
+
+		location, e = newRegistryLocation(s)
+		if e != nil {
+			e = errors.Annotatef(e, "allowed location %q", s)
+
+			return
+		}
+
+		l.locations = append(l.locations, location)
+	}
+
+	return
+}
+
+func (l *imageAllowList) AllowsImage(reference ImageReference) (allowed bool) {
+	const (
+		pathSeparator = "/"
+	)
+
+	var (
+		location registryLocation
+		target   registryLocation
+
+		e error
+	)
+
+	// all images are allowed if no locations are
+	if len(l.locations) == 0 {
+		allowed = true
+
+		return
+	}
+
+	target, e = newRegistryLocation(reference.RepositoryName)
+	if e != nil {
+		return
+	}
+
+	// unlike for credentials, paths match whole components only,
+	// so that "registry/team" allows "registry/team/app" but not "registry/teams"
+	for _, location = range l.locations {
+		if location.Matches(target) && (location.path == target.path ||
+			strings.HasPrefix(target.path, location.path+pathSeparator)) {
+			allowed = true
+
+			return
+		}
+	}
+
+	return
+}
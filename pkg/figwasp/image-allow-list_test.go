@@ -0,0 +1,70 @@
+package figwasp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageAllowList(t *testing.T) {
+	type testCase struct {
+		locations []string
+		image     string
+		allowed   bool
+	}
+
+	var (
+		testCases []testCase
+
+		allowList *imageAllowList
+		reference ImageReference
+		test      testCase
+
+		e error
+	)
+
+	testCases = []testCase{
+		{nil, "registry.internal:5000/app:1.0.0", true}, // no restrictions
+		{[]string{""}, "busybox", true},
+		{[]string{"registry.internal:5000"},
+			"registry.internal:5000/app:1.0.0", true},
+		{[]string{"registry.internal:5000"},
+			"registry.internal:5001/app:1.0.0", false},
+		{[]string{"registry.internal:5000"}, "busybox:1.35", false},
+		{[]string{"docker.io/library"}, "busybox:1.35", true},
+		{[]string{"docker.io/library"}, "grafana/grafana:9.0.0", false},
+		{[]string{"index.docker.io"}, "grafana/grafana:9.0.0", true},
+		{[]string{"registry.io/team"}, "registry.io/team/app", true},
+		{[]string{"registry.io/team"}, "registry.io/team", true},
+		{[]string{"registry.io/team"}, "registry.io/teams/app", false},
+		{[]string{"registry.io/team/"}, "registry.io/team/app", true},
+		{[]string{"*.example.com"}, "eu.example.com/app", true},
+		{[]string{"*.example.com"}, "example.com/app", false},
+		{[]string{"*.example.com"}, "eu.example.com.evil/app", false},
+		{[]string{"registry.internal:5000", "quay.io/prometheus"},
+			"quay.io/prometheus/node-exporter:v1.3.1", true},
+		{[]string{"registry.internal:5000", "quay.io/prometheus"},
+			"quay.io/coreos/etcd:v3.5.0", false},
+	}
+
+	for _, test = range testCases {
+		allowList, e = NewImageAllowList(test.locations...)
+		if e != nil {
+			t.Error(test.locations, e)
+		}
+
+		reference, e = NewImageReferenceFromString(test.image)
+		if e != nil {
+			t.Error(test.image, e)
+		}
+
+		assert.Equal(t, test.allowed, allowList.AllowsImage(reference),
+			test.locations,
+			test.image,
+		)
+	}
+
+	_, e = NewImageAllowList("https://")
+
+	assert.Error(t, e)
+}
@@ -0,0 +1,115 @@
+package figwasp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type imageDigestCache struct {
+	entries map[string]*imageDigestCacheEntry
+	mutex   *sync.Mutex
+	ttl     time.Duration
+}
+
+func NewImageDigestCache(ttl time.Duration) (c *imageDigestCache, e error) {
+	if ttl < 0 {
+		e = errors.NotValidf("time-to-live %s", ttl)
+
+		return
+	}
+
+	c = &imageDigestCache{
+		entries: make(map[string]*imageDigestCacheEntry),
+		mutex:   new(sync.Mutex),
+		ttl:     ttl, // 0: entries never expire
+	}
+
+	return
+}
+
+func (c *imageDigestCache) RetrieveImageDigest(
+	imageReferenceString string, ctx context.Context,
+	retrieve func(string, context.Context) (string, error),
+) (
+	imageDigestString string, e error,
+) {
+	var (
+		entry *imageDigestCacheEntry
+		found bool
+	)
+
+	c.mutex.Lock()
+
+	entry, found = c.entries[imageReferenceString]
+	if found && c.expired(entry) {
+		found = false
+	}
+
+	if !found {
+		entry = &imageDigestCacheEntry{
+			done: make(chan struct{}),
+		}
+
+		c.entries[imageReferenceString] = entry
+	}
+
+	c.mutex.Unlock()
+
+	if !found {
+		entry.digest, entry.e = retrieve(imageReferenceString, ctx)
+
+		entry.retrieved = time.Now()
+
+		if entry.e != nil {
+			c.mutex.Lock()
+
+			if c.entries[imageReferenceString] == entry {
+				delete(c.entries, imageReferenceString) // do not cache failures
+			}
+
+			c.mutex.Unlock()
+		}
+
+		close(entry.done)
+	}
+
+	select {
+	case <-entry.done:
+		imageDigestString, e = entry.digest, entry.e
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+	case <-ctx.Done():
+		e = errors.Trace(
+			ctx.Err(),
+		)
+
+		return
+	}
+
+	return
+}
+
+func (c *imageDigestCache) expired(entry *imageDigestCacheEntry) bool {
+	select {
+	case <-entry.done:
+		return c.ttl > 0 && time.Since(entry.retrieved) > c.ttl
+
+	default:
+		return false // retrieval in flight
+	}
+}
+
+type imageDigestCacheEntry struct {
+	done      chan struct{}
+	retrieved time.Time
+
+	digest string
+	e      error
+}
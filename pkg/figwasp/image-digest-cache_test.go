@@ -0,0 +1,177 @@
+package figwasp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageDigestCache(t *testing.T) {
+	const (
+		imageRef    = "docker.io/library/busybox:latest"
+		imageDigest = "sha256:" +
+			"7cc4b5aefd1d0cadf8d97d4350462ba51c694ebca145b08d7d41b41acc8db5aa"
+
+		nCallers = 10
+		delay    = time.Millisecond * 100
+	)
+
+	var (
+		cache *imageDigestCache
+
+		nRetrievals int32
+		retrieve    func(string, context.Context) (string, error)
+		waitGroup   *sync.WaitGroup
+
+		e error
+		i int
+	)
+
+	retrieve = func(string, context.Context) (digest string, e error) {
+		atomic.AddInt32(&nRetrievals, 1)
+
+		time.Sleep(delay) // keep retrieval in flight for concurrent callers
+
+		digest = imageDigest
+
+		return
+	}
+
+	cache, e = NewImageDigestCache(0)
+	if e != nil {
+		t.Error(e)
+	}
+
+	waitGroup = new(sync.WaitGroup)
+
+	waitGroup.Add(nCallers)
+
+	for i = 0; i < nCallers; i++ {
+		go func() {
+			var (
+				digest string
+				e      error
+			)
+
+			defer waitGroup.Done()
+
+			digest, e = cache.RetrieveImageDigest(imageRef,
+				context.Background(),
+				retrieve,
+			)
+			if e != nil {
+				t.Error(e)
+			}
+
+			assert.Equal(t, imageDigest, digest)
+		}()
+	}
+
+	waitGroup.Wait()
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.EqualValues(t,
+		1,
+		atomic.LoadInt32(&nRetrievals),
+	)
+}
+
+func TestImageDigestCacheWithTTL(t *testing.T) {
+	const (
+		imageRef    = "docker.io/library/busybox:latest"
+		imageDigest = "sha256:" +
+			"7cc4b5aefd1d0cadf8d97d4350462ba51c694ebca145b08d7d41b41acc8db5aa"
+
+		ttl = time.Millisecond * 100
+	)
+
+	var (
+		cache *imageDigestCache
+
+		nRetrievals int
+		retrieve    func(string, context.Context) (string, error)
+
+		e error
+	)
+
+	retrieve = func(string, context.Context) (digest string, e error) {
+		nRetrievals++
+
+		digest = imageDigest
+
+		return
+	}
+
+	cache, e = NewImageDigestCache(ttl)
+	if e != nil {
+		t.Error(e)
+	}
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+	if e != nil {
+		t.Error(e)
+	}
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t, 1, nRetrievals)
+
+	time.Sleep(ttl * 2)
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t, 2, nRetrievals)
+}
+
+func TestImageDigestCacheDoesNotCacheFailures(t *testing.T) {
+	const (
+		imageRef = "docker.io/library/busybox:latest"
+	)
+
+	var (
+		cache *imageDigestCache
+
+		nRetrievals int
+		retrieve    func(string, context.Context) (string, error)
+
+		e error
+	)
+
+	retrieve = func(string, context.Context) (digest string, e error) {
+		nRetrievals++
+
+		e = errors.New("registry unavailable")
+
+		return
+	}
+
+	cache, e = NewImageDigestCache(0)
+	if e != nil {
+		t.Error(e)
+	}
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+
+	assert.Error(t, e)
+
+	_, e = cache.RetrieveImageDigest(imageRef, context.Background(), retrieve)
+
+	assert.Error(t, e)
+
+	assert.Equal(t, 2, nRetrievals)
+}
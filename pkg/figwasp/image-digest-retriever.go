@@ -2,20 +2,37 @@ package figwasp
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	"github.com/juju/errors"
 	"github.com/opencontainers/go-digest"
+	"golang.org/x/time/rate"
 )
 
 type imageDigestRetriever struct {
 	systemContext *types.SystemContext
 	pathsToRemove []string
+	rateLimiter   *rate.Limiter
+
+	retryAttempts     int
+	retryDelayInitial time.Duration
+	retryDelayMaximum time.Duration
 }
 
 func NewImageDigestRetriever(options ...imageDigestRetrieverOption) (
@@ -28,6 +45,9 @@ func NewImageDigestRetriever(options ...imageDigestRetrieverOption) (
 	r = &imageDigestRetriever{
 		systemContext: &types.SystemContext{},
 		pathsToRemove: []string{},
+		rateLimiter:   rate.NewLimiter(rate.Inf, 0),
+
+		retryAttempts: 1, // no retries
 	}
 
 	for _, option = range options {
@@ -46,6 +66,166 @@ func (r *imageDigestRetriever) RetrieveImageDigest(
 	imageReferenceString string, ctx context.Context,
 ) (
 	imageDigestString string, e error,
+) {
+	e = r.retry(imageReferenceString, ctx,
+		func() (e error) {
+			imageDigestString, e = r.retrieveImageDigestOnce(
+				imageReferenceString,
+				ctx,
+			)
+
+			return
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) ListRepositoryTags(
+	repositoryName string, ctx context.Context,
+) (
+	tags []string, e error,
+) {
+	e = r.retry(repositoryName, ctx,
+		func() (e error) {
+			tags, e = r.listRepositoryTagsOnce(repositoryName, ctx)
+
+			return
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) RetrieveImageCreated(
+	imageReferenceString string, ctx context.Context,
+) (
+	created time.Time, e error,
+) {
+	e = r.retry(imageReferenceString, ctx,
+		func() (e error) {
+			created, e = r.retrieveImageCreatedOnce(imageReferenceString, ctx)
+
+			return
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) RetrieveImageSignatures(
+	repositoryName, imageDigestString string, ctx context.Context,
+) (
+	signatures []ImageSignature, e error,
+) {
+	e = r.retry(repositoryName, ctx,
+		func() (e error) {
+			signatures, e = r.retrieveImageSignaturesOnce(
+				repositoryName,
+				imageDigestString,
+				ctx,
+			)
+
+			return
+		},
+	)
+
+	// an image not signed is not an error, but an image without signatures
+	if ClassifyRegistryError(e) == RegistryErrorNotFound {
+		e = nil
+	}
+
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) retry(
+	name string, ctx context.Context, f func() error,
+) (
+	e error,
+) {
+	var (
+		attempt int
+		class   RegistryErrorClass
+		delay   time.Duration
+		advised time.Duration
+		timer   *time.Timer
+	)
+
+	for attempt = 1; ; attempt++ {
+		e = f()
+		if e == nil {
+			return
+		}
+
+		class = ClassifyRegistryError(e)
+
+		if !class.Retryable() || attempt >= r.retryAttempts {
+			e = errors.Trace(
+				&RegistryError{
+					Class:    class,
+					Attempts: attempt,
+					Err:      e,
+				},
+			)
+
+			return
+		}
+
+		delay = r.retryDelay(attempt)
+
+		// the registry's own advice is the least that is waited
+		advised = r.retryAfter(name, ctx)
+		if advised > delay {
+			delay = advised
+		}
+
+		timer = time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+			continue
+
+		case <-ctx.Done():
+			timer.Stop()
+
+			e = errors.Trace(
+				&RegistryError{
+					Class:    class,
+					Attempts: attempt,
+					Err:      e,
+				},
+			)
+
+			return
+		}
+	}
+}
+
+func (r *imageDigestRetriever) retrieveImageDigestOnce(
+	imageReferenceString string, ctx context.Context,
+) (
+	imageDigestString string, e error,
 ) {
 	const (
 		imageReferenceFormat = "//%s"
@@ -58,6 +238,13 @@ func (r *imageDigestRetriever) RetrieveImageDigest(
 		ImageReference types.ImageReference
 	)
 
+	e = r.rateLimiter.Wait(ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
 	ImageReference, e = docker.ParseReference(
 		fmt.Sprintf(imageReferenceFormat, imageReferenceString),
 	)
@@ -74,6 +261,8 @@ func (r *imageDigestRetriever) RetrieveImageDigest(
 		return
 	}
 
+	defer imageCloser.Close()
+
 	imageManifest, _, e = imageCloser.Manifest(ctx)
 	if e != nil {
 		e = errors.Trace(e)
@@ -93,6 +282,372 @@ func (r *imageDigestRetriever) RetrieveImageDigest(
 	return
 }
 
+func (r *imageDigestRetriever) retrieveImageCreatedOnce(
+	imageReferenceString string, ctx context.Context,
+) (
+	created time.Time, e error,
+) {
+	const (
+		imageReferenceFormat = "//%s"
+	)
+
+	var (
+		imageCloser    types.ImageCloser
+		imageInspected *types.ImageInspectInfo
+		ImageReference types.ImageReference
+	)
+
+	e = r.rateLimiter.Wait(ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ImageReference, e = docker.ParseReference(
+		fmt.Sprintf(imageReferenceFormat, imageReferenceString),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	imageCloser, e = ImageReference.NewImage(ctx, r.systemContext)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	defer imageCloser.Close()
+
+	// from the "created" field of the image configuration,
+	// of the image for this platform if the tag is of a list
+	imageInspected, e = imageCloser.Inspect(ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if imageInspected.Created == nil {
+		e = errors.NotFoundf("creation time of %s", imageReferenceString)
+
+		return
+	}
+
+	created = *imageInspected.Created
+
+	return
+}
+
+func (r *imageDigestRetriever) retrieveImageSignaturesOnce(
+	repositoryName, imageDigestString string, ctx context.Context,
+) (
+	signatures []ImageSignature, e error,
+) {
+	const (
+		imageReferenceFormat = "//%s:%s-%s.sig" // as tagged by cosign
+
+		signatureAnnotationKey = "dev.cosignproject.cosign/signature"
+		payloadSizeMaximum     = 1 << 20
+	)
+
+	var (
+		blob           io.ReadCloser
+		found          bool
+		i              int
+		imageDigest    digest.Digest
+		imageManifest  []byte
+		ImageReference types.ImageReference
+		imageSource    types.ImageSource
+		layer          types.BlobInfo
+		oci            *manifest.OCI1
+		payload        []byte
+		signature      []byte
+		signature64    string
+	)
+
+	imageDigest, e = digest.Parse(imageDigestString)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = r.rateLimiter.Wait(ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ImageReference, e = docker.ParseReference(
+		fmt.Sprintf(imageReferenceFormat,
+			repositoryName,
+			imageDigest.Algorithm(),
+			imageDigest.Encoded(),
+		),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	imageSource, e = ImageReference.NewImageSource(ctx, r.systemContext)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	defer imageSource.Close()
+
+	imageManifest, _, e = imageSource.GetManifest(ctx, nil)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	oci, e = manifest.OCI1FromManifest(imageManifest)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// a layer per signature, its payload the blob and its signature annotated
+	for i = 0; i < len(oci.Layers); i++ {
+		signature64, found = oci.Layers[i].Annotations[signatureAnnotationKey]
+		if !found || oci.Layers[i].Size > payloadSizeMaximum {
+			continue
+		}
+
+		layer = types.BlobInfo{
+			Digest: oci.Layers[i].Digest,
+			Size:   oci.Layers[i].Size,
+		}
+
+		e = layer.Digest.Validate()
+		if e != nil {
+			e = errors.NewNotValid(e, "signature of "+imageDigestString)
+
+			return
+		}
+
+		signature, e = base64.StdEncoding.DecodeString(signature64)
+		if e != nil {
+			e = errors.NewNotValid(e, "signature of "+imageDigestString)
+
+			return
+		}
+
+		blob, _, e = imageSource.GetBlob(ctx, layer, none.NoCache)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		payload, e = ioutil.ReadAll(
+			io.LimitReader(blob, payloadSizeMaximum),
+		)
+
+		blob.Close()
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if layer.Digest.Algorithm().FromBytes(payload) != layer.Digest {
+			e = errors.NotValidf("payload %s of signature of %s",
+				layer.Digest,
+				imageDigestString,
+			)
+
+			return
+		}
+
+		signatures = append(signatures,
+			ImageSignature{
+				Payload:   payload,
+				Signature: signature,
+			},
+		)
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) listRepositoryTagsOnce(
+	repositoryName string, ctx context.Context,
+) (
+	tags []string, e error,
+) {
+	const (
+		imageReferenceFormat = "//%s"
+	)
+
+	var (
+		ImageReference types.ImageReference
+	)
+
+	e = r.rateLimiter.Wait(ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	ImageReference, e = docker.ParseReference(
+		fmt.Sprintf(imageReferenceFormat, repositoryName),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	tags, e = docker.GetRepositoryTags(ctx, r.systemContext, ImageReference)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (r *imageDigestRetriever) retryDelay(attempt int) (delay time.Duration) {
+	delay = r.retryDelayInitial << (attempt - 1) // exponential
+
+	if delay > r.retryDelayMaximum || delay <= 0 {
+		delay = r.retryDelayMaximum
+	}
+
+	delay = delay/2 + time.Duration(
+		rand.Int63n(int64(delay/2)+1),
+	) // "equal jitter"
+
+	return
+}
+
+func (r *imageDigestRetriever) retryAfter(name string, ctx context.Context) (
+	delay time.Duration,
+) {
+	const (
+		probeURLFormat = "https://%s/v2/"
+		retryAfterKey  = "Retry-After"
+
+		dockerHostname = "docker.io"
+		dockerRegistry = "registry-1.docker.io" // as by containers/image
+	)
+
+	var (
+		certDir    string
+		client     *http.Client
+		host       string
+		named      reference.Named
+		request    *http.Request
+		response   *http.Response
+		retryAfter string
+		seconds    int
+		tlsConfig  *tls.Config
+		when       time.Time
+
+		e error
+	)
+
+	// containers/image discards the headers of the responses it fails on,
+	// so the registry is asked again, at its API root, for its advice
+	named, e = reference.ParseNormalizedNamed(name)
+	if e != nil {
+		return
+	}
+
+	host = reference.Domain(named)
+
+	if host == dockerHostname {
+		host = dockerRegistry
+	}
+
+	tlsConfig = &tls.Config{
+		InsecureSkipVerify: r.systemContext.DockerInsecureSkipTLSVerify ==
+			types.OptionalBoolTrue,
+	}
+
+	// as for the registry client, but for the default directories
+	certDir = r.systemContext.DockerCertPath
+
+	if certDir == "" && r.systemContext.DockerPerHostCertDirPath != "" {
+		certDir = filepath.Join(r.systemContext.DockerPerHostCertDirPath, host)
+	}
+
+	if certDir != "" {
+		e = tlsclientconfig.SetupCertificates(certDir, tlsConfig)
+		if e != nil {
+			return
+		}
+	}
+
+	client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	defer client.CloseIdleConnections()
+
+	e = r.rateLimiter.Wait(ctx)
+	if e != nil {
+		return
+	}
+
+	request, e = http.NewRequestWithContext(ctx,
+		http.MethodHead,
+		fmt.Sprintf(probeURLFormat, host),
+		nil,
+	)
+	if e != nil {
+		return
+	}
+
+	response, e = client.Do(request)
+	if e != nil {
+		return
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusTooManyRequests &&
+		response.StatusCode < http.StatusInternalServerError {
+		return
+	}
+
+	// in seconds, or as a date
+	retryAfter = response.Header.Get(retryAfterKey)
+
+	seconds, e = strconv.Atoi(retryAfter)
+	if e == nil && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+
+		return
+	}
+
+	when, e = http.ParseTime(retryAfter)
+	if e == nil {
+		delay = time.Until(when)
+	}
+
+	return
+}
+
 func (r *imageDigestRetriever) Destroy() (e error) {
 	var (
 		path string
@@ -116,11 +671,106 @@ func WithBasicAuthentication(username, password string) (
 	option imageDigestRetrieverOption,
 ) {
 	option = func(r *imageDigestRetriever) (e error) {
-		r.systemContext.DockerAuthConfig = &types.DockerAuthConfig{
-			Username: username,
-			Password: password,
+		if r.systemContext.DockerAuthConfig == nil {
+			r.systemContext.DockerAuthConfig = &types.DockerAuthConfig{}
+		}
+
+		r.systemContext.DockerAuthConfig.Username = username
+
+		r.systemContext.DockerAuthConfig.Password = password
+
+		return
+	}
+
+	return
+}
+
+func WithIdentityToken(identityToken string) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		if r.systemContext.DockerAuthConfig == nil {
+			r.systemContext.DockerAuthConfig = &types.DockerAuthConfig{}
+		}
+
+		// exchanged for an access token by OAuth2 refresh_token grant
+		r.systemContext.DockerAuthConfig.IdentityToken = identityToken
+
+		return
+	}
+
+	return
+}
+
+func WithBearerToken(registryToken string) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		r.systemContext.DockerBearerRegistryToken = registryToken
+		// presented as is, without consulting the token service
+
+		return
+	}
+
+	return
+}
+
+func WithPerHostCertificateDirectory(pathToDir string) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		r.systemContext.DockerPerHostCertDirPath = pathToDir
+
+		return
+	}
+
+	return
+}
+
+func WithRegistriesConfiguration(pathToConfig string) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		r.systemContext.SystemRegistriesConfPath = pathToConfig
+
+		return
+	}
+
+	return
+}
+
+func WithRateLimiter(rateLimiter *rate.Limiter) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		r.rateLimiter = rateLimiter // may be shared by retrievers
+
+		return
+	}
+
+	return
+}
+
+func WithRetries(attempts int, delayInitial, delayMaximum time.Duration) (
+	option imageDigestRetrieverOption,
+) {
+	option = func(r *imageDigestRetriever) (e error) {
+		if attempts < 1 || delayInitial < 0 || delayMaximum < delayInitial {
+			e = errors.NotValidf("retry policy %d, %s, %s",
+				attempts,
+				delayInitial,
+				delayMaximum,
+			)
+
+			return
 		}
 
+		r.retryAttempts = attempts
+
+		r.retryDelayInitial = delayInitial
+
+		r.retryDelayMaximum = delayMaximum
+
 		return
 	}
 
@@ -158,7 +808,7 @@ func WithSelfSignedTLSCertificate(pathToCACert string) (
 
 		pathToCACertLink = fmt.Sprintf(pathToCACertLinkFormat, pathToCACertDir)
 
-		e = os.Link(pathToCACert, pathToCACertLink)
+		e = os.Symlink(pathToCACert, pathToCACertLink)
 		if e != nil {
 			e = errors.Trace(e)
 
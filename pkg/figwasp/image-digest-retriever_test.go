@@ -2,17 +2,29 @@ package figwasp
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
 
 	creds "github.com/figwasp/figwasp/test/pkg/credentials"
 	"github.com/figwasp/figwasp/test/pkg/images"
 	"github.com/figwasp/figwasp/test/pkg/repositories"
+	"github.com/figwasp/figwasp/test/pkg/servers"
 )
 
 func TestImageDigestRetrieverAgainstPublicRepository(t *testing.T) {
@@ -193,3 +205,855 @@ func TestImageDigestRetrieverAgainstPrivateRepositoryWithBasicAuthAndTLS(
 		len(imageDigest.Encoded()),
 	)
 }
+
+func TestImageDigestRetrieverWithRateLimiter(t *testing.T) {
+	const (
+		imageRef = "" // invalid; rejected only after the rate limiter waits
+
+		rateLimit = 10 // requests per second
+		rateBurst = 1
+
+		nRequests = 3
+
+		durationMinimum = time.Second / rateLimit * (nRequests - rateBurst)
+	)
+
+	var (
+		retriever *imageDigestRetriever
+
+		start time.Time
+
+		e error
+		i int
+	)
+
+	retriever, e = NewImageDigestRetriever(
+		WithRateLimiter(
+			rate.NewLimiter(rateLimit, rateBurst),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	start = time.Now()
+
+	for i = 0; i < nRequests; i++ {
+		_, e = retriever.RetrieveImageDigest(imageRef,
+			context.Background(),
+		)
+
+		assert.Error(t, e)
+	}
+
+	assert.GreaterOrEqual(t,
+		time.Since(start),
+		durationMinimum,
+	)
+}
+
+func TestImageDigestRetrieverRetriesAgainstScriptedRegistry(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5003
+
+		imageRefFormat = "%s:%d/scripted:latest"
+
+		retryAttempts     = 3
+		retryDelayInitial = time.Millisecond * 10
+		retryDelayMaximum = time.Millisecond * 100
+
+		retryAfter = 1 // second
+	)
+
+	type testCase struct {
+		responses []servers.ScriptedResponse
+
+		class            RegistryErrorClass // if retrieval is to fail
+		durationMinimum  time.Duration
+		manifestRequests int
+	}
+
+	var (
+		testCases map[string]testCase
+
+		credential        *creds.TLSCertificate
+		repository        *servers.RegistryServer
+		repositoryAddress net.TCPAddr
+
+		retriever *imageDigestRetriever
+
+		imageDigestString string
+		imageRef          string
+		name              string
+		start             time.Time
+		test              testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"transient errors are retried": {
+			responses: []servers.ScriptedResponse{
+				{StatusCode: http.StatusServiceUnavailable},
+				{StatusCode: http.StatusBadGateway},
+			},
+			manifestRequests: 3,
+		},
+		"transient errors exhaust retries": {
+			responses: []servers.ScriptedResponse{
+				{StatusCode: http.StatusServiceUnavailable},
+				{StatusCode: http.StatusServiceUnavailable},
+				{StatusCode: http.StatusServiceUnavailable},
+			},
+			class:            RegistryErrorTransient,
+			manifestRequests: 3,
+		},
+		"Retry-After is honoured": {
+			responses: []servers.ScriptedResponse{
+				{
+					StatusCode: http.StatusTooManyRequests,
+					RetryAfter: fmt.Sprint(retryAfter),
+				},
+			},
+			durationMinimum:  time.Second * retryAfter,
+			manifestRequests: 2,
+		},
+		"Retry-After of transient errors is honoured": {
+			responses: []servers.ScriptedResponse{
+				{
+					StatusCode: http.StatusServiceUnavailable,
+					RetryAfter: fmt.Sprint(retryAfter),
+				},
+			},
+			durationMinimum:  time.Second * retryAfter,
+			manifestRequests: 2,
+		},
+		"rate limiting is not retried again": {
+			responses: []servers.ScriptedResponse{
+				{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"},
+				{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"},
+				{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"},
+				{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"},
+				{StatusCode: http.StatusTooManyRequests, RetryAfter: "0"},
+			},
+			class:            RegistryErrorRateLimited,
+			manifestRequests: 5, // by github.com/containers/image/v5/docker
+		},
+		"not found is not retried": {
+			responses: []servers.ScriptedResponse{
+				{StatusCode: http.StatusNotFound},
+			},
+			class:            RegistryErrorNotFound,
+			manifestRequests: 1,
+		},
+		"authentication failure is not retried": {
+			responses: []servers.ScriptedResponse{
+				{StatusCode: http.StatusUnauthorized},
+			},
+			class:            RegistryErrorAuthentication,
+			manifestRequests: 1,
+		},
+	}
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: repositoryPort,
+	}
+
+	imageRef = fmt.Sprintf(imageRefFormat, repositoryHost, repositoryPort)
+
+	retriever, e = NewImageDigestRetriever(
+		WithRetries(retryAttempts, retryDelayInitial, retryDelayMaximum),
+		WithSelfSignedTLSCertificate(
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	for name, test = range testCases {
+		repository, e = servers.NewRegistryServer(
+			servers.WithScriptedResponses(test.responses...),
+			servers.WithTransportLayerSecurity(
+				credential.PathToCertPEM(),
+				credential.PathToKeyPEM(),
+			),
+		)
+		if e != nil {
+			t.Error(e)
+		}
+
+		e = repository.ServeAtAddress(repositoryAddress)
+		if e != nil {
+			t.Error(e)
+		}
+
+		start = time.Now()
+
+		imageDigestString, e = retriever.RetrieveImageDigest(imageRef,
+			context.Background(),
+		)
+
+		if test.class == RegistryErrorUnclassified {
+			assert.NoError(t, e, name)
+
+			assert.Equal(t,
+				repository.ManifestDigest(),
+				imageDigestString,
+				name,
+			)
+
+		} else {
+			assert.Equal(t,
+				test.class,
+				ClassifyRegistryError(e),
+				name,
+			)
+		}
+
+		assert.GreaterOrEqual(t,
+			time.Since(start),
+			test.durationMinimum,
+			name,
+		)
+
+		assert.Equal(t,
+			test.manifestRequests,
+			repository.ManifestRequests(),
+			name,
+		)
+
+		repository.Close()
+	}
+}
+
+func TestImageDigestRetrieverTokenAuthentication(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5005
+
+		imageRefFormat = "%s:%d/token:latest"
+
+		identityToken = "identity-token"
+		accessToken   = "access-token"
+	)
+
+	type testCase struct {
+		options []imageDigestRetrieverOption
+
+		class RegistryErrorClass // if retrieval is to fail
+	}
+
+	var (
+		testCases map[string]testCase
+
+		credential        *creds.TLSCertificate
+		repository        *servers.RegistryServer
+		repositoryAddress net.TCPAddr
+
+		retriever *imageDigestRetriever
+
+		imageDigestString string
+		imageRef          string
+		name              string
+		test              testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"identity token is exchanged for an access token": {
+			options: []imageDigestRetrieverOption{
+				WithIdentityToken(identityToken),
+			},
+		},
+		"identity token survives basic authentication": {
+			options: []imageDigestRetrieverOption{
+				WithIdentityToken(identityToken),
+				WithBasicAuthentication("<token>", ""),
+			},
+		},
+		"bearer token is presented as is": {
+			options: []imageDigestRetrieverOption{
+				WithBearerToken(accessToken),
+			},
+		},
+		"invalid identity token is refused": {
+			options: []imageDigestRetrieverOption{
+				WithIdentityToken("invalid"),
+			},
+			class: RegistryErrorAuthentication,
+		},
+		"invalid bearer token is refused": {
+			options: []imageDigestRetrieverOption{
+				WithBearerToken("invalid"),
+			},
+			class: RegistryErrorAuthentication,
+		},
+	}
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: repositoryPort,
+	}
+
+	repository, e = servers.NewRegistryServer(
+		servers.WithTokenAuthentication(identityToken, accessToken),
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository.ServeAtAddress(repositoryAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Close()
+
+	imageRef = fmt.Sprintf(imageRefFormat, repositoryHost, repositoryPort)
+
+	for name, test = range testCases {
+		retriever, e = NewImageDigestRetriever(
+			append(test.options,
+				WithSelfSignedTLSCertificate(
+					credential.PathToCertPEM(),
+				),
+			)...,
+		)
+		if e != nil {
+			t.Error(e)
+		}
+
+		imageDigestString, e = retriever.RetrieveImageDigest(imageRef,
+			context.Background(),
+		)
+
+		if test.class == RegistryErrorUnclassified {
+			assert.NoError(t, e, name)
+
+			assert.Equal(t,
+				repository.ManifestDigest(),
+				imageDigestString,
+				name,
+			)
+
+		} else {
+			assert.Equal(t,
+				test.class,
+				ClassifyRegistryError(e),
+				name,
+			)
+		}
+
+		retriever.Destroy()
+	}
+}
+
+func TestImageDigestRetrieverListRepositoryTags(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5016
+
+		repositoryNameFormat = "%s:%d/tagged"
+	)
+
+	var (
+		credential        *creds.TLSCertificate
+		repository        *servers.RegistryServer
+		repositoryAddress net.TCPAddr
+
+		retriever *imageDigestRetriever
+
+		tags     []string
+		tagsWant []string
+
+		e error
+	)
+
+	tagsWant = []string{"1.2.3", "1.2.4", "latest"}
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: repositoryPort,
+	}
+
+	repository, e = servers.NewRegistryServer(
+		servers.WithTags(tagsWant...),
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository.ServeAtAddress(repositoryAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Close()
+
+	retriever, e = NewImageDigestRetriever(
+		WithSelfSignedTLSCertificate(
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	tags, e = retriever.ListRepositoryTags(
+		fmt.Sprintf(repositoryNameFormat, repositoryHost, repositoryPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t, tagsWant, tags)
+}
+
+func TestImageDigestRetrieverRetrieveImageCreated(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5019
+
+		imageReferenceFormat = "%s:%d/created:main-20261017-ab12cd3"
+	)
+
+	var (
+		credential        *creds.TLSCertificate
+		repository        *servers.RegistryServer
+		repositoryAddress net.TCPAddr
+
+		retriever *imageDigestRetriever
+
+		created     time.Time
+		createdWant time.Time
+
+		e error
+	)
+
+	createdWant = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: repositoryPort,
+	}
+
+	repository, e = servers.NewRegistryServer(
+		servers.WithImageCreated(createdWant),
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository.ServeAtAddress(repositoryAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Close()
+
+	retriever, e = NewImageDigestRetriever(
+		WithSelfSignedTLSCertificate(
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	created, e = retriever.RetrieveImageCreated(
+		fmt.Sprintf(imageReferenceFormat, repositoryHost, repositoryPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.True(t, createdWant.Equal(created))
+}
+
+func TestImageDigestRetrieverRetrieveImageSignatures(t *testing.T) {
+	const (
+		repositoryHost  = "127.0.0.1"
+		repositoryPort0 = 5025 // signed
+		repositoryPort1 = 5026 // not signed
+
+		repositoryNameFormat = "%s:%d/signed"
+
+		keysFilename = "cosign.pub"
+	)
+
+	var (
+		credential  *creds.TLSCertificate
+		repository0 *servers.RegistryServer
+		repository1 *servers.RegistryServer
+
+		retriever *imageDigestRetriever
+
+		key        *ecdsa.PrivateKey
+		pathToKeys string
+		publicDER  []byte
+		signatures []ImageSignature
+		verifier   *imageSignatureVerifier
+
+		e error
+	)
+
+	key, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Error(e)
+	}
+
+	publicDER, e = x509.MarshalPKIXPublicKey(key.Public())
+	if e != nil {
+		t.Error(e)
+	}
+
+	pathToKeys = filepath.Join(t.TempDir(), keysFilename)
+
+	e = ioutil.WriteFile(pathToKeys,
+		pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "PUBLIC KEY",
+				Bytes: publicDER,
+			},
+		),
+		0600,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repository0, e = servers.NewRegistryServer(
+		servers.WithSignature(
+			func(payload []byte) ([]byte, error) {
+				var (
+					hashed [sha256.Size]byte
+				)
+
+				hashed = sha256.Sum256(payload)
+
+				return ecdsa.SignASN1(rand.Reader, key, hashed[:])
+			},
+		),
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository0.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(repositoryHost),
+			Port: repositoryPort0,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository0.Close()
+
+	repository1, e = servers.NewRegistryServer(
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository1.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(repositoryHost),
+			Port: repositoryPort1,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository1.Close()
+
+	retriever, e = NewImageDigestRetriever(
+		WithSelfSignedTLSCertificate(
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	verifier, e = NewImageSignatureVerifier(pathToKeys)
+	if e != nil {
+		t.Error(e)
+	}
+
+	signatures, e = retriever.RetrieveImageSignatures(
+		fmt.Sprintf(repositoryNameFormat, repositoryHost, repositoryPort0),
+		repository0.ManifestDigest(),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Len(t, signatures, 1)
+
+	e = verifier.VerifyImageSignatures(repository0.ManifestDigest(),
+		signatures,
+	)
+
+	assert.NoError(t, e)
+
+	signatures, e = retriever.RetrieveImageSignatures(
+		fmt.Sprintf(repositoryNameFormat, repositoryHost, repositoryPort1),
+		repository1.ManifestDigest(),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Empty(t, signatures)
+
+	e = verifier.VerifyImageSignatures(repository1.ManifestDigest(),
+		signatures,
+	)
+
+	assert.Error(t, e)
+}
+
+func TestImageDigestRetrieverRetrieveImageSignaturesOfTagSelected(
+	t *testing.T,
+) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5028 // not signed
+
+		repositoryNameFormat = "%s:%d/tagged"
+		imageRefFormat       = "%s:%s"
+
+		constraint = ">= 1.0.0"
+		currentTag = "1.0.0"
+		newTag     = "1.1.0"
+
+		keysFilename = "cosign.pub"
+	)
+
+	var (
+		credential *creds.TLSCertificate
+		repository *servers.RegistryServer
+
+		policy    *semverTagPolicy
+		retriever *imageDigestRetriever
+		verifier  *imageSignatureVerifier
+
+		imageDigest    string
+		key            *ecdsa.PrivateKey
+		pathToKeys     string
+		publicDER      []byte
+		repositoryName string
+		selectedTag    string
+		signatures     []ImageSignature
+		tags           []string
+
+		e error
+	)
+
+	key, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Error(e)
+	}
+
+	publicDER, e = x509.MarshalPKIXPublicKey(key.Public())
+	if e != nil {
+		t.Error(e)
+	}
+
+	pathToKeys = filepath.Join(t.TempDir(), keysFilename)
+
+	e = ioutil.WriteFile(pathToKeys,
+		pem.EncodeToMemory(
+			&pem.Block{
+				Type:  "PUBLIC KEY",
+				Bytes: publicDER,
+			},
+		),
+		0600,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repository, e = servers.NewRegistryServer(
+		servers.WithTags(currentTag, newTag),
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(repositoryHost),
+			Port: repositoryPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Close()
+
+	retriever, e = NewImageDigestRetriever(
+		WithSelfSignedTLSCertificate(
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	policy, e = NewSemverTagPolicy(constraint)
+	if e != nil {
+		t.Error(e)
+	}
+
+	verifier, e = NewImageSignatureVerifier(pathToKeys)
+	if e != nil {
+		t.Error(e)
+	}
+
+	repositoryName = fmt.Sprintf(repositoryNameFormat,
+		repositoryHost,
+		repositoryPort,
+	)
+
+	tags, e = retriever.ListRepositoryTags(repositoryName,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	// an unsigned tag matching the policy is selected, but not verified
+	selectedTag = policy.SelectTag(currentTag, tags)
+
+	assert.Equal(t, newTag, selectedTag)
+
+	imageDigest, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryName, selectedTag),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	signatures, e = retriever.RetrieveImageSignatures(repositoryName,
+		imageDigest,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Empty(t, signatures)
+
+	e = verifier.VerifyImageSignatures(imageDigest, signatures)
+
+	assert.Error(t, e)
+}
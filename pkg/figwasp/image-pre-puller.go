@@ -0,0 +1,344 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	prePullLabelKey = "figwasp/prePull" // valued with the deployment name
+)
+
+var (
+	prePullReasons = map[string]bool{ // of containers waiting on their images
+		"ContainerCreating": true,
+		"ErrImagePull":      true,
+		"ImagePullBackOff":  true,
+	}
+)
+
+type imagePrePuller struct {
+	deployments typedAppsV1.DeploymentInterface
+	lister      *deploymentPodLister
+	pods        typedCoreV1.PodInterface
+	interval    time.Duration
+	timeout     time.Duration // of the removal of pods
+}
+
+func NewImagePrePuller(config *rest.Config, namespace string) (
+	p *imagePrePuller, e error,
+) {
+	const (
+		interval = time.Second * 2
+		timeout  = time.Second * 30
+	)
+
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	p = &imagePrePuller{
+		deployments: clientset.AppsV1().Deployments(namespace),
+		pods:        clientset.CoreV1().Pods(namespace),
+		interval:    interval,
+		timeout:     timeout,
+	}
+
+	p.lister, e = NewDeploymentPodLister(config, namespace)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (p *imagePrePuller) PrePullImages(
+	deploymentName string, images []string, ctx context.Context,
+) (
+	pulled bool, e error, // not pulled if ctx is done first
+) {
+	var (
+		created    *coreV1.Pod
+		deployment *appsV1.Deployment
+		image      string
+		node       string
+		nodes      map[string]bool
+		pod        coreV1.Pod
+		pods       []coreV1.Pod
+		podNames   []string
+	)
+
+	if len(images) == 0 {
+		pulled = true
+
+		return
+	}
+
+	deployment, e = p.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	pods, e = p.lister.ListPods(deploymentName, ctx)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	nodes = make(map[string]bool)
+
+	for _, pod = range pods {
+		if pod.Spec.NodeName != "" {
+			nodes[pod.Spec.NodeName] = true
+		}
+	}
+
+	// removed however the pre-pull ends, by when ctx may be done
+	defer func() { p.deletePods(podNames) }()
+
+	// a pod per image, so that an image whose pod fails holds up no other
+	for node = range nodes {
+		for _, image = range images {
+			created, e = p.pods.Create(ctx,
+				p.newPod(deployment, node, image, ctx),
+				metaV1.CreateOptions{},
+			)
+
+			// not pulled in time, rather than failed
+			if e != nil && ctx.Err() != nil {
+				e = nil
+
+				return
+			}
+
+			if e != nil {
+				e = errors.Annotatef(e, "pre-pull of %s on node %s", image, node)
+
+				return
+			}
+
+			podNames = append(podNames, created.Name)
+		}
+	}
+
+	e = wait.PollImmediateUntil(p.interval,
+		func() (done bool, e error) {
+			return p.pulled(podNames, ctx)
+		},
+		ctx.Done(),
+	)
+
+	switch {
+	case e == nil:
+		pulled = true
+
+	case e == wait.ErrWaitTimeout:
+		e = nil
+
+	default:
+		e = errors.Trace(e)
+	}
+
+	return
+}
+
+func (p *imagePrePuller) newPod(
+	deployment *appsV1.Deployment, node string, image string,
+	ctx context.Context,
+) (
+	pod *coreV1.Pod,
+) {
+	const (
+		containerName = "image"
+		podNameFormat = "%s-pre-pull-"
+
+		cpu    = "10m"
+		memory = "16Mi"
+
+		userNobody = 65534
+	)
+
+	var (
+		automount    bool
+		deadline     time.Time
+		escalation   bool
+		ok           bool
+		resources    coreV1.ResourceRequirements
+		runAsNonRoot bool
+		runAsUser    int64
+		seconds      int64
+		template     coreV1.PodSpec
+	)
+
+	runAsNonRoot, runAsUser = true, userNobody
+
+	template = deployment.Spec.Template.Spec
+
+	resources = coreV1.ResourceRequirements{
+		Limits: coreV1.ResourceList{
+			coreV1.ResourceCPU:    resource.MustParse(cpu),
+			coreV1.ResourceMemory: resource.MustParse(memory),
+		},
+		Requests: coreV1.ResourceList{
+			coreV1.ResourceCPU:    resource.MustParse(cpu),
+			coreV1.ResourceMemory: resource.MustParse(memory),
+		},
+	}
+
+	pod = &coreV1.Pod{
+		ObjectMeta: metaV1.ObjectMeta{
+			GenerateName: fmt.Sprintf(podNameFormat, deployment.Name),
+			Labels: map[string]string{
+				prePullLabelKey: deployment.Name,
+			},
+		},
+		Spec: coreV1.PodSpec{
+			// bound to a node of the deployment's, as its own pods are
+			NodeName:      node,
+			RestartPolicy: coreV1.RestartPolicyNever,
+			Tolerations:   template.Tolerations,
+
+			// pulled with the credentials of the deployment's own pods
+			ImagePullSecrets:             template.ImagePullSecrets,
+			ServiceAccountName:           template.ServiceAccountName,
+			AutomountServiceAccountToken: &automount,
+
+			// as admitted under the "restricted" Pod Security Standard
+			SecurityContext: &coreV1.PodSecurityContext{
+				RunAsNonRoot: &runAsNonRoot,
+				RunAsUser:    &runAsUser,
+				SeccompProfile: &coreV1.SeccompProfile{
+					Type: coreV1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+
+			// the image is pulled, but its entrypoint not run; were "true"
+			// missing from it, or not runnable as nobody, the container
+			// would fail, but after the pull, and is not restarted
+			Containers: []coreV1.Container{
+				{
+					Name:            containerName,
+					Image:           image,
+					ImagePullPolicy: coreV1.PullIfNotPresent,
+					Command:         []string{"true"},
+					Resources:       resources,
+					SecurityContext: &coreV1.SecurityContext{
+						AllowPrivilegeEscalation: &escalation,
+						Capabilities: &coreV1.Capabilities{
+							Drop: []coreV1.Capability{"ALL"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// so that pods left behind by an interrupted pre-pull are not left running
+	deadline, ok = ctx.Deadline()
+	if ok {
+		seconds = int64(time.Until(deadline)/time.Second) + 1
+
+		pod.Spec.ActiveDeadlineSeconds = &seconds
+	}
+
+	return
+}
+
+func (p *imagePrePuller) pulled(podNames []string, ctx context.Context) (
+	done bool, e error,
+) {
+	var (
+		pod     *coreV1.Pod
+		podName string
+		status  coreV1.ContainerStatus
+	)
+
+	for _, podName = range podNames {
+		pod, e = p.pods.Get(ctx,
+			podName,
+			metaV1.GetOptions{},
+		)
+
+		// not pulled in time, rather than failed
+		if e != nil && ctx.Err() != nil {
+			e = nil
+
+			return
+		}
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if len(pod.Status.ContainerStatuses) == 0 {
+			return
+		}
+
+		// an image is pulled once its container is past waiting on it,
+		// whether or not the container then runs
+		for _, status = range pod.Status.ContainerStatuses {
+			if status.State.Waiting != nil &&
+				(status.State.Waiting.Reason == "" ||
+					prePullReasons[status.State.Waiting.Reason]) {
+				return
+			}
+		}
+	}
+
+	done = true
+
+	return
+}
+
+func (p *imagePrePuller) deletePods(podNames []string) {
+	var (
+		cancel      context.CancelFunc
+		ctx         context.Context
+		gracePeriod int64
+		podName     string
+	)
+
+	ctx, cancel = context.WithTimeout(context.Background(), p.timeout)
+
+	defer cancel()
+
+	for _, podName = range podNames {
+		p.pods.Delete(ctx,
+			podName,
+			metaV1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			},
+		) // left to their active deadline if they cannot be removed
+	}
+
+	return
+}
@@ -0,0 +1,468 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clientTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestImagePrePuller(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5024
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag = "1.0.0"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-image-pre-puller-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+		replicas       = 2
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithReplicas(replicas),
+		deployments.WithContainerWithTCPPorts(imageName,
+			strings.ReplaceAll(
+				fmt.Sprintf(imageRefFormat,
+					repositoryAddressLocal.String(),
+					imageName,
+					tag,
+				),
+				localhost,
+				dockerHost,
+			),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		labelSelectorFormat = "%s=%s"
+		masterURL           = ""
+		timeout             = time.Minute * 2
+	)
+
+	var (
+		cancel        context.CancelFunc
+		cancelExpired context.CancelFunc
+		clientset     *kubernetes.Clientset
+		config        *rest.Config
+		ctx           context.Context
+		done          bool
+		expired       context.Context
+		imageRef      string
+		pod           v1.Pod
+		podList       *v1.PodList
+		prePuller     *imagePrePuller
+		pulled        bool
+		remaining     []string
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	prePuller, e = NewImagePrePuller(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+
+	defer cancel()
+
+	imageRef = strings.ReplaceAll(
+		fmt.Sprintf(imageRefFormat,
+			repositoryAddressLocal.String(),
+			imageName,
+			tag,
+		),
+		localhost,
+		dockerHost,
+	)
+
+	pulled, e = prePuller.PrePullImages(deploymentName,
+		[]string{imageRef},
+		ctx,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.True(t, pulled)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		t.Error(e)
+	}
+
+	podList, e = clientset.CoreV1().Pods(v1.NamespaceDefault).List(ctx,
+		metaV1.ListOptions{
+			LabelSelector: fmt.Sprintf(labelSelectorFormat,
+				prePullLabelKey,
+				deploymentName,
+			),
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for _, pod = range podList.Items {
+		if pod.DeletionTimestamp == nil {
+			remaining = append(remaining, pod.Name)
+		}
+	}
+
+	assert.Empty(t, remaining)
+
+	// a pre-pull cut short is not pulled, but not failed either
+	expired, cancelExpired = context.WithCancel(context.Background())
+
+	cancelExpired()
+
+	done, e = prePuller.pulled([]string{"any"}, expired)
+
+	assert.NoError(t, e)
+
+	assert.False(t, done)
+
+	_, e = prePuller.PrePullImages("missing",
+		[]string{imageRef},
+		ctx,
+	)
+
+	assert.Error(t, e)
+}
+
+func TestImagePrePullerWithPodsNotCreated(t *testing.T) {
+	const (
+		deploymentName = "figwasp"
+		imageRef       = "registry.test/figwasp:2.0.0"
+		nodeName       = "node-0"
+	)
+
+	type testCase struct {
+		createError func(cancel context.CancelFunc) error
+		failed      bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		cancel    context.CancelFunc
+		clientset *fake.Clientset
+		ctx       context.Context
+		name      string
+		prePuller *imagePrePuller
+		pulled    bool
+		test      testCase
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"pods not admitted fail the pre-pull": {
+			createError: func(context.CancelFunc) error {
+				return apiErrors.NewForbidden(
+					schema.GroupResource{Resource: "pods"},
+					"",
+					fmt.Errorf("violates PodSecurity \"restricted:latest\""),
+				)
+			},
+			failed: true,
+		},
+		"pods not created in time are not pulled": {
+			createError: func(cancel context.CancelFunc) error {
+				cancel()
+
+				return context.Canceled
+			},
+		},
+	}
+
+	for name, test = range testCases {
+		clientset = newPrePullClientset(deploymentName, nodeName)
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+
+		clientset.PrependReactor("create", "pods",
+			func(clientTesting.Action) (bool, runtime.Object, error) {
+				return true, nil, test.createError(cancel)
+			},
+		)
+
+		prePuller = &imagePrePuller{
+			deployments: clientset.AppsV1().Deployments(v1.NamespaceDefault),
+			lister: &deploymentPodLister{
+				deployments: clientset.AppsV1().Deployments(v1.NamespaceDefault),
+				replicaSets: clientset.AppsV1().ReplicaSets(v1.NamespaceDefault),
+				pods:        clientset.CoreV1().Pods(v1.NamespaceDefault),
+			},
+			pods:     clientset.CoreV1().Pods(v1.NamespaceDefault),
+			interval: time.Millisecond,
+			timeout:  time.Second,
+		}
+
+		pulled, e = prePuller.PrePullImages(deploymentName,
+			[]string{imageRef},
+			ctx,
+		)
+
+		cancel()
+
+		assert.Equal(t, test.failed, e != nil, name)
+
+		assert.False(t, pulled, name)
+	}
+}
+
+func TestImagePrePullerPodIsRestricted(t *testing.T) {
+	const (
+		imageRef = "registry.test/figwasp:2.0.0"
+	)
+
+	var (
+		container v1.Container
+		pod       *v1.Pod
+	)
+
+	pod = (&imagePrePuller{}).newPod(
+		&appsV1.Deployment{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: "figwasp",
+			},
+		},
+		"node-0",
+		imageRef,
+		context.Background(),
+	)
+
+	assert.Empty(t, pod.Spec.InitContainers)
+
+	assert.Equal(t, v1.RestartPolicyNever, pod.Spec.RestartPolicy)
+
+	if assert.NotNil(t, pod.Spec.SecurityContext) {
+		assert.True(t, *pod.Spec.SecurityContext.RunAsNonRoot)
+
+		assert.NotZero(t, *pod.Spec.SecurityContext.RunAsUser)
+
+		assert.Equal(t,
+			v1.SeccompProfileTypeRuntimeDefault,
+			pod.Spec.SecurityContext.SeccompProfile.Type,
+		)
+	}
+
+	if assert.Len(t, pod.Spec.Containers, 1) {
+		container = pod.Spec.Containers[0]
+
+		assert.Equal(t, imageRef, container.Image)
+
+		assert.Equal(t, []string{"true"}, container.Command)
+
+		if assert.NotNil(t, container.SecurityContext) {
+			assert.False(t, *container.SecurityContext.AllowPrivilegeEscalation)
+
+			assert.Equal(t,
+				[]v1.Capability{"ALL"},
+				container.SecurityContext.Capabilities.Drop,
+			)
+		}
+	}
+}
+
+func newPrePullClientset(deploymentName, nodeName string) (
+	clientset *fake.Clientset,
+) {
+	var (
+		controller bool
+		deployment *appsV1.Deployment
+		replicaSet *appsV1.ReplicaSet
+	)
+
+	controller = true
+
+	deployment = &appsV1.Deployment{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: v1.NamespaceDefault,
+			UID:       types.UID(deploymentName),
+		},
+	}
+
+	replicaSet = &appsV1.ReplicaSet{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      deploymentName + "-0",
+			Namespace: v1.NamespaceDefault,
+			UID:       types.UID(deploymentName + "-0"),
+			OwnerReferences: []metaV1.OwnerReference{
+				{
+					Name:       deploymentName,
+					UID:        deployment.UID,
+					Controller: &controller,
+				},
+			},
+		},
+	}
+
+	clientset = fake.NewSimpleClientset(deployment,
+		replicaSet,
+		&v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      deploymentName + "-0-0",
+				Namespace: v1.NamespaceDefault,
+				OwnerReferences: []metaV1.OwnerReference{
+					{
+						Name:       replicaSet.Name,
+						UID:        replicaSet.UID,
+						Controller: &controller,
+					},
+				},
+			},
+			Spec: v1.PodSpec{
+				NodeName: nodeName,
+			},
+		},
+	)
+
+	return
+}
@@ -0,0 +1,154 @@
+package figwasp
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentImagePullSecretLister struct {
+	deployments     typedAppsV1.DeploymentInterface
+	secrets         typedCoreV1.SecretInterface
+	serviceAccounts typedCoreV1.ServiceAccountInterface
+}
+
+func NewDeploymentImagePullSecretLister(config *rest.Config, namespace string) (
+	l *deploymentImagePullSecretLister, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	l = &deploymentImagePullSecretLister{
+		deployments:     clientset.AppsV1().Deployments(namespace),
+		secrets:         clientset.CoreV1().Secrets(namespace),
+		serviceAccounts: clientset.CoreV1().ServiceAccounts(namespace),
+	}
+
+	return
+}
+
+func (l *deploymentImagePullSecretLister) ListImagePullSecrets(
+	deploymentName string, ctx context.Context,
+) (
+	secrets []coreV1.Secret, e error,
+) {
+	var (
+		deployment *appsV1.Deployment
+		reference  coreV1.LocalObjectReference
+		references []coreV1.LocalObjectReference
+		secret     *coreV1.Secret
+	)
+
+	deployment, e = l.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	references, e = l.listImagePullSecretReferences(
+		deployment.Spec.Template.Spec,
+		ctx,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	for _, reference = range references {
+		secret, e = l.secrets.Get(ctx,
+			reference.Name,
+			metaV1.GetOptions{},
+		)
+		if apiErrors.IsNotFound(e) {
+			e = nil
+
+			continue // kubelet likewise pulls without missing secrets
+		}
+
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		secrets = append(secrets, *secret)
+	}
+
+	return
+}
+
+func (l *deploymentImagePullSecretLister) listImagePullSecretReferences(
+	podSpec coreV1.PodSpec, ctx context.Context,
+) (
+	references []coreV1.LocalObjectReference, e error,
+) {
+	const (
+		serviceAccountNameDefault = "default"
+	)
+
+	var (
+		serviceAccount     *coreV1.ServiceAccount
+		serviceAccountName string
+	)
+
+	references = podSpec.ImagePullSecrets
+
+	if len(references) > 0 {
+		return
+	}
+
+	// as admitted by the ServiceAccount admission controller,
+	// pods inherit the imagePullSecrets of their ServiceAccount
+	// only when they specify none themselves
+
+	serviceAccountName = podSpec.ServiceAccountName
+
+	if serviceAccountName == "" {
+		serviceAccountName = podSpec.DeprecatedServiceAccount
+	}
+
+	if serviceAccountName == "" {
+		serviceAccountName = serviceAccountNameDefault
+	}
+
+	serviceAccount, e = l.serviceAccounts.Get(ctx,
+		serviceAccountName,
+		metaV1.GetOptions{},
+	)
+	if apiErrors.IsNotFound(e) {
+		e = nil
+
+		return
+	}
+
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	references = serviceAccount.ImagePullSecrets
+
+	return
+}
@@ -1,12 +1,15 @@
 package figwasp
 
 import (
+	"sort"
+
 	"github.com/juju/errors"
 	"k8s.io/api/core/v1"
 )
 
 type imageReferenceLister struct {
 	references map[string]ImageReference
+	pods       map[string][]string // names, by image ID
 }
 
 func NewImageReferenceListerFromPods(pods []v1.Pod) (
@@ -22,10 +25,16 @@ func NewImageReferenceListerFromPods(pods []v1.Pod) (
 
 	l = &imageReferenceLister{
 		references: make(map[string]ImageReference),
+		pods:       make(map[string][]string),
 	}
 
 	for _, pod = range pods {
 		for _, containerStatus = range pod.Status.ContainerStatuses {
+			l.pods[containerStatus.ImageID] = append(
+				l.pods[containerStatus.ImageID],
+				pod.Name,
+			)
+
 			_, ok = l.references[containerStatus.ImageID]
 			if ok {
 				continue
@@ -63,3 +72,35 @@ func (l *imageReferenceLister) ListImageReferences() (list []ImageReference) {
 
 	return
 }
+
+func (l *imageReferenceLister) ListPodNames(reference ImageReference) (
+	list []string,
+) {
+	var (
+		imageID string
+		listed  map[string]bool
+		name    string
+		other   ImageReference
+	)
+
+	listed = make(map[string]bool)
+
+	// of pods with a container running the image by that digest
+	for imageID, other = range l.references {
+		if other != reference {
+			continue
+		}
+
+		for _, name = range l.pods[imageID] {
+			if !listed[name] {
+				list = append(list, name)
+
+				listed[name] = true
+			}
+		}
+	}
+
+	sort.Strings(list)
+
+	return
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestImageReferenceLister(t *testing.T) {
@@ -24,13 +25,17 @@ func TestImageReferenceLister(t *testing.T) {
 	var (
 		pods []v1.Pod
 
-		lister *imageReferenceLister
+		lister    *imageReferenceLister
+		reference ImageReference
 
 		e error
 	)
 
 	pods = []v1.Pod{
 		{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: "pod-0",
+			},
 			Status: v1.PodStatus{
 				ContainerStatuses: []v1.ContainerStatus{
 					{
@@ -53,6 +58,9 @@ func TestImageReferenceLister(t *testing.T) {
 
 	pods = append(pods,
 		v1.Pod{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: "pod-1",
+			},
 			Status: v1.PodStatus{
 				ContainerStatuses: []v1.ContainerStatus{
 					{
@@ -75,4 +83,24 @@ func TestImageReferenceLister(t *testing.T) {
 		nUniqueImages,
 		len(lister.ListImageReferences()),
 	)
+
+	reference, e = NewImageReferenceFromCanonicalString(canonicalString0)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		[]string{"pod-0", "pod-1"},
+		lister.ListPodNames(reference),
+	)
+
+	reference, e = NewImageReferenceFromCanonicalString(canonicalString1)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		[]string{"pod-1"},
+		lister.ListPodNames(reference),
+	)
 }
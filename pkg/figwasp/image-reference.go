@@ -7,32 +7,78 @@ import (
 
 type ImageReference struct {
 	RepositoryAddress string
+	RepositoryName    string
 	NamedAndTagged    string
+	Tag               string
 	ImageDigest       string
 }
 
 func NewImageReferenceFromCanonicalString(s string) (
 	r ImageReference, e error,
 ) {
-	const (
-		defaultTag = "latest"
+	var (
+		named reference.Named
 	)
 
+	named, e = reference.ParseNamed(s)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	r, e = newImageReference(named)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if r.ImageDigest == "" {
+		e = errors.NotValidf("image reference %s without digest", s)
+
+		return
+	}
+
+	return
+}
+
+func NewImageReferenceFromString(s string) (r ImageReference, e error) {
 	var (
-		named       reference.Named
-		namedTagged reference.NamedTagged
-		ok          bool
-		tag         string
-		tagged      reference.Tagged
+		named reference.Named
 	)
 
-	named, e = reference.ParseNamed(s)
+	// as in pod specs, e.g. "busybox:1.35" for "docker.io/library/busybox"
+	named, e = reference.ParseNormalizedNamed(s)
 	if e != nil {
 		e = errors.Trace(e)
 
 		return
 	}
 
+	r, e = newImageReference(named)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func newImageReference(named reference.Named) (r ImageReference, e error) {
+	const (
+		defaultTag = "latest"
+	)
+
+	var (
+		digested    reference.Digested
+		namedTagged reference.NamedTagged
+		ok          bool
+		tag         string
+		tagged      reference.Tagged
+	)
+
 	tagged, ok = named.(reference.Tagged)
 
 	if ok {
@@ -54,8 +100,15 @@ func NewImageReferenceFromCanonicalString(s string) (
 
 	r = ImageReference{
 		RepositoryAddress: reference.Domain(named),
+		RepositoryName:    reference.TrimNamed(named).String(),
 		NamedAndTagged:    namedTagged.String(),
-		ImageDigest:       named.(reference.Digested).Digest().String(),
+		Tag:               tag,
+	}
+
+	digested, ok = named.(reference.Digested)
+
+	if ok {
+		r.ImageDigest = digested.Digest().String()
 	}
 
 	return
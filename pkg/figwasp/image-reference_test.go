@@ -9,7 +9,8 @@ import (
 func TestImageReference(t *testing.T) {
 	const (
 		repositoryAddress = "docker.io"
-		namedAndTagged    = repositoryAddress + "/library/busybox:latest"
+		repositoryName    = repositoryAddress + "/library/busybox"
+		namedAndTagged    = repositoryName + ":latest"
 		imageDigest       = "sha256:" +
 			"7cc4b5aefd1d0cadf8d97d4350462ba51c694ebca145b08d7d41b41acc8db5aa"
 
@@ -32,6 +33,11 @@ func TestImageReference(t *testing.T) {
 		reference.RepositoryAddress,
 	)
 
+	assert.Equal(t,
+		repositoryName,
+		reference.RepositoryName,
+	)
+
 	assert.Equal(t,
 		namedAndTagged,
 		reference.NamedAndTagged,
@@ -41,4 +47,48 @@ func TestImageReference(t *testing.T) {
 		imageDigest,
 		reference.ImageDigest,
 	)
+
+	_, e = NewImageReferenceFromCanonicalString(namedAndTagged)
+
+	assert.Error(t, e)
+}
+
+func TestImageReferenceFromString(t *testing.T) {
+	const (
+		repositoryName = "docker.io/library/busybox"
+		tag            = "1.35.0"
+		namedAndTagged = repositoryName + ":" + tag
+
+		imageString = "busybox:" + tag
+	)
+
+	var (
+		reference ImageReference
+
+		e error
+	)
+
+	reference, e = NewImageReferenceFromString(imageString)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		repositoryName,
+		reference.RepositoryName,
+	)
+
+	assert.Equal(t,
+		namedAndTagged,
+		reference.NamedAndTagged,
+	)
+
+	assert.Equal(t,
+		tag,
+		reference.Tag,
+	)
+
+	assert.Empty(t,
+		reference.ImageDigest,
+	)
 }
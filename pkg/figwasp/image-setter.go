@@ -0,0 +1,126 @@
+package figwasp
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentImageSetter struct {
+	deployments typedAppsV1.DeploymentInterface
+}
+
+func NewDeploymentImageSetter(config *rest.Config, namespace string) (
+	s *deploymentImageSetter, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	s = &deploymentImageSetter{
+		deployments: clientset.AppsV1().Deployments(namespace),
+	}
+
+	return
+}
+
+func (s *deploymentImageSetter) SetImages(
+	deploymentName string, images map[string]string, ctx context.Context,
+) (
+	e error,
+) {
+	const (
+		annotationKey = "figwasp/restartedAt"
+	)
+
+	var (
+		deployment *appsV1.Deployment
+		found      bool
+		image      string
+		name       string
+		set        map[string]bool
+
+		i int
+	)
+
+	deployment, e = s.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	set = make(map[string]bool)
+
+	// as "kubectl set image", by container name; the rollout that follows
+	// is that of any change to the pod template
+	for i = range deployment.Spec.Template.Spec.InitContainers {
+		name = deployment.Spec.Template.Spec.InitContainers[i].Name
+
+		image, found = images[name]
+		if found {
+			deployment.Spec.Template.Spec.InitContainers[i].Image = image
+
+			set[name] = true
+		}
+	}
+
+	for i = range deployment.Spec.Template.Spec.Containers {
+		name = deployment.Spec.Template.Spec.Containers[i].Name
+
+		image, found = images[name]
+		if found {
+			deployment.Spec.Template.Spec.Containers[i].Image = image
+
+			set[name] = true
+		}
+	}
+
+	for name = range images {
+		if !set[name] {
+			e = errors.NotFoundf("container %s in deployment %s",
+				name,
+				deploymentName,
+			)
+
+			return
+		}
+	}
+
+	// as by a restart, from which a cooldown is counted
+	if deployment.Spec.Template.ObjectMeta.Annotations == nil {
+		deployment.Spec.Template.ObjectMeta.Annotations =
+			make(map[string]string)
+	}
+
+	deployment.Spec.Template.ObjectMeta.Annotations[annotationKey] =
+		time.Now().Format(time.RFC3339)
+
+	_, e = s.deployments.Update(ctx,
+		deployment,
+		metaV1.UpdateOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,250 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestDeploymentImageSetter(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5018
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag0 = "1.0.0"
+		tag1 = "1.0.1"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag0,
+			),
+		),
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag1,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-image-setter-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithContainerWithTCPPorts(imageName,
+			fmt.Sprintf(imageRefFormat,
+				strings.ReplaceAll(
+					repositoryAddressLocal.String(),
+					localhost,
+					dockerHost,
+				),
+				imageName,
+				tag0,
+			),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		masterURL = ""
+	)
+
+	var (
+		config *rest.Config
+		getter *deploymentGetter
+		setter *deploymentImageSetter
+
+		got      appsV1.Deployment
+		imageRef string
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	setter, e = NewDeploymentImageSetter(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	imageRef = fmt.Sprintf(imageRefFormat,
+		strings.ReplaceAll(
+			repositoryAddressLocal.String(),
+			localhost,
+			dockerHost,
+		),
+		imageName,
+		tag1,
+	)
+
+	e = setter.SetImages(deploymentName,
+		map[string]string{
+			imageName: imageRef,
+		},
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	getter, e = NewDeploymentGetter(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	got, e = getter.GetDeployment(deploymentName,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	if assert.Len(t, got.Spec.Template.Spec.Containers, 1) {
+		assert.Equal(t,
+			imageRef,
+			got.Spec.Template.Spec.Containers[0].Image,
+		)
+	}
+
+	assert.Contains(t,
+		got.Spec.Template.ObjectMeta.Annotations,
+		"figwasp/restartedAt",
+	)
+
+	// containers missing from the deployment are not silently ignored
+	e = setter.SetImages(deploymentName,
+		map[string]string{
+			"missing": imageRef,
+		},
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+}
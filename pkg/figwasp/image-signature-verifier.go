@@ -0,0 +1,188 @@
+package figwasp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+)
+
+const (
+	imageSignatureType = "cosign container image signature"
+)
+
+type ImageSignature struct {
+	Payload   []byte // in the "simple signing" format
+	Signature []byte // of the payload
+}
+
+type imageSignatureVerifier struct {
+	publicKeys []crypto.PublicKey
+}
+
+func NewImageSignatureVerifier(pathsToPublicKeys ...string) (
+	v *imageSignatureVerifier, e error,
+) {
+	var (
+		block         *pem.Block
+		keysPEM       []byte
+		pathToKeys    string
+		publicKey     crypto.PublicKey
+		publicKeysPEM []byte
+	)
+
+	v = &imageSignatureVerifier{}
+
+	// e.g. "cosign.pub", as written by "cosign generate-key-pair"
+	for _, pathToKeys = range pathsToPublicKeys {
+		publicKeysPEM, e = ioutil.ReadFile(pathToKeys)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		for keysPEM = publicKeysPEM; ; {
+			block, keysPEM = pem.Decode(keysPEM)
+			if block == nil {
+				break
+			}
+
+			publicKey, e = x509.ParsePKIXPublicKey(block.Bytes)
+			if e != nil {
+				e = errors.NewNotValid(e, pathToKeys)
+
+				return
+			}
+
+			switch publicKey.(type) {
+			case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+
+			default:
+				e = errors.NotSupportedf("public key of type %T in %s",
+					publicKey,
+					pathToKeys,
+				)
+
+				return
+			}
+
+			v.publicKeys = append(v.publicKeys, publicKey)
+		}
+	}
+
+	if len(v.publicKeys) == 0 {
+		e = errors.NotFoundf("public keys in %v", pathsToPublicKeys)
+
+		return
+	}
+
+	return
+}
+
+func (v *imageSignatureVerifier) VerifyImageSignatures(
+	imageDigest string, signatures []ImageSignature,
+) (
+	e error,
+) {
+	var (
+		publicKey crypto.PublicKey
+		signature ImageSignature
+	)
+
+	if len(signatures) == 0 {
+		e = errors.NotFoundf("signatures of image %s", imageDigest)
+
+		return
+	}
+
+	// verified by any one signature, of the image, by any one key
+	for _, signature = range signatures {
+		if !signsImage(signature.Payload, imageDigest) {
+			continue
+		}
+
+		for _, publicKey = range v.publicKeys {
+			if verifySignature(publicKey, signature) {
+				return
+			}
+		}
+	}
+
+	e = errors.NotValidf("signatures of image %s", imageDigest)
+
+	return
+}
+
+func signsImage(payload []byte, imageDigest string) bool {
+	var (
+		e       error
+		signing simpleSigning
+	)
+
+	e = json.Unmarshal(payload, &signing)
+	if e != nil {
+		return false
+	}
+
+	return signing.Critical.Type == imageSignatureType &&
+		signing.Critical.Image.DockerManifestDigest == imageDigest
+}
+
+func verifySignature(publicKey crypto.PublicKey, signature ImageSignature) (
+	verified bool,
+) {
+	var (
+		ecdsaKey   *ecdsa.PublicKey
+		ed25519Key ed25519.PublicKey
+		hashed     [sha256.Size]byte
+		ok         bool
+		rsaKey     *rsa.PublicKey
+	)
+
+	hashed = sha256.Sum256(signature.Payload)
+
+	// as signed by cosign, with the default hash of keys of each type
+	ecdsaKey, ok = publicKey.(*ecdsa.PublicKey)
+	if ok {
+		return ecdsa.VerifyASN1(ecdsaKey, hashed[:], signature.Signature)
+	}
+
+	rsaKey, ok = publicKey.(*rsa.PublicKey)
+	if ok {
+		return rsa.VerifyPKCS1v15(rsaKey,
+			crypto.SHA256,
+			hashed[:],
+			signature.Signature,
+		) == nil
+	}
+
+	ed25519Key, ok = publicKey.(ed25519.PublicKey)
+	if ok {
+		return ed25519.Verify(ed25519Key,
+			signature.Payload,
+			signature.Signature,
+		)
+	}
+
+	return
+}
+
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
@@ -0,0 +1,241 @@
+package figwasp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageSignatureVerifier(t *testing.T) {
+	const (
+		imageDigest = "sha256:" +
+			"0000000000000000000000000000000000000000000000000000000000000001"
+		otherDigest = "sha256:" +
+			"0000000000000000000000000000000000000000000000000000000000000002"
+
+		dockerReference = "127.0.0.1:5000/image"
+		otherReference  = "127.0.0.1:5000/other"
+
+		payloadFormat = `{"critical":{` +
+			`"identity":{"docker-reference":"` + dockerReference + `"},` +
+			`"image":{"docker-manifest-digest":"%s"},` +
+			`"type":"%s"` +
+			`},"optional":null}`
+		otherType = "atomic container signature"
+
+		keysFilename = "cosign.pub"
+	)
+
+	type testCase struct {
+		signature ImageSignature
+		verified  bool
+	}
+
+	var (
+		ecdsaKey   *ecdsa.PrivateKey
+		ed25519Key ed25519.PrivateKey
+		otherKey   *ecdsa.PrivateKey
+		rsaKey     *rsa.PrivateKey
+
+		keysPEM    []byte
+		pathToKeys string
+		payload    []byte
+		publicKey  crypto.PublicKey
+		publicDER  []byte
+		tampered   []byte
+
+		testCases []testCase
+		test      testCase
+		verifier  *imageSignatureVerifier
+
+		e error
+	)
+
+	ecdsaKey, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Error(e)
+	}
+
+	otherKey, e = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Error(e)
+	}
+
+	rsaKey, e = rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Error(e)
+	}
+
+	_, ed25519Key, e = ed25519.GenerateKey(rand.Reader)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for _, publicKey = range []crypto.PublicKey{
+		ecdsaKey.Public(),
+		rsaKey.Public(),
+		ed25519Key.Public(),
+	} {
+		publicDER, e = x509.MarshalPKIXPublicKey(publicKey)
+		if e != nil {
+			t.Error(e)
+		}
+
+		keysPEM = append(keysPEM,
+			pem.EncodeToMemory(
+				&pem.Block{
+					Type:  "PUBLIC KEY",
+					Bytes: publicDER,
+				},
+			)...,
+		)
+	}
+
+	pathToKeys = filepath.Join(t.TempDir(), keysFilename)
+
+	e = ioutil.WriteFile(pathToKeys, keysPEM, 0600)
+	if e != nil {
+		t.Error(e)
+	}
+
+	verifier, e = NewImageSignatureVerifier(pathToKeys)
+	if e != nil {
+		t.Error(e)
+	}
+
+	payload = []byte(
+		fmt.Sprintf(payloadFormat, imageDigest, imageSignatureType),
+	)
+
+	// of the same image, but not as signed
+	tampered = []byte(
+		strings.Replace(string(payload), dockerReference, otherReference, 1),
+	)
+
+	testCases = []testCase{
+		{signECDSA(t, ecdsaKey, payload), true},
+		{signRSA(t, rsaKey, payload), true},
+		{signEd25519(ed25519Key, payload), true},
+		{signECDSA(t, otherKey, payload), false}, // by a key not configured
+		{
+			signECDSA(t, ecdsaKey,
+				[]byte(
+					fmt.Sprintf(payloadFormat, otherDigest, imageSignatureType),
+				),
+			),
+			false, // of another image
+		},
+		{
+			signECDSA(t, ecdsaKey,
+				[]byte(
+					fmt.Sprintf(payloadFormat, imageDigest, otherType),
+				),
+			),
+			false, // of another type
+		},
+		{
+			ImageSignature{
+				Payload:   tampered,
+				Signature: signECDSA(t, ecdsaKey, payload).Signature,
+			},
+			false, // of another payload
+		},
+	}
+
+	for _, test = range testCases {
+		e = verifier.VerifyImageSignatures(imageDigest,
+			[]ImageSignature{test.signature},
+		)
+
+		assert.Equal(t, test.verified, e == nil, string(test.signature.Payload))
+	}
+
+	// verified by any one of several signatures
+	e = verifier.VerifyImageSignatures(imageDigest,
+		[]ImageSignature{
+			signECDSA(t, otherKey, payload),
+			signECDSA(t, ecdsaKey, payload),
+		},
+	)
+
+	assert.NoError(t, e)
+
+	e = verifier.VerifyImageSignatures(imageDigest, nil)
+
+	assert.Error(t, e)
+
+	_, e = NewImageSignatureVerifier(
+		filepath.Join(t.TempDir(), keysFilename),
+	)
+
+	assert.Error(t, e)
+}
+
+func signECDSA(t *testing.T, key *ecdsa.PrivateKey, payload []byte) (
+	signature ImageSignature,
+) {
+	var (
+		hashed [sha256.Size]byte
+
+		e error
+	)
+
+	hashed = sha256.Sum256(payload)
+
+	signature.Payload = payload
+
+	signature.Signature, e = ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	if e != nil {
+		t.Error(e)
+	}
+
+	return
+}
+
+func signRSA(t *testing.T, key *rsa.PrivateKey, payload []byte) (
+	signature ImageSignature,
+) {
+	var (
+		hashed [sha256.Size]byte
+
+		e error
+	)
+
+	hashed = sha256.Sum256(payload)
+
+	signature.Payload = payload
+
+	signature.Signature, e = rsa.SignPKCS1v15(rand.Reader,
+		key,
+		crypto.SHA256,
+		hashed[:],
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	return
+}
+
+func signEd25519(key ed25519.PrivateKey, payload []byte) (
+	signature ImageSignature,
+) {
+	signature.Payload = payload
+
+	signature.Signature = ed25519.Sign(key, payload)
+
+	return
+}
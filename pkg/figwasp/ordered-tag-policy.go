@@ -0,0 +1,158 @@
+package figwasp
+
+import (
+	"math/big"
+	"regexp"
+
+	"github.com/juju/errors"
+)
+
+type orderedTagPolicy struct {
+	pattern *tagPattern
+	less    func(string, string) bool // on sort keys
+}
+
+func NewAlphabeticalTagPolicy(pattern string) (p *orderedTagPolicy, e error) {
+	p = &orderedTagPolicy{
+		less: func(a, b string) bool {
+			return a < b
+		},
+	}
+
+	p.pattern, e = newTagPattern(pattern)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func NewNumericalTagPolicy(pattern string) (p *orderedTagPolicy, e error) {
+	p = &orderedTagPolicy{
+		less: func(a, b string) bool {
+			return numberOf(a).Cmp(numberOf(b)) < 0
+		},
+	}
+
+	p.pattern, e = newTagPattern(pattern)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// keys that are not numbers are not matched, so as not to be compared
+	p.pattern.valid = func(key string) bool {
+		return numberOf(key) != nil
+	}
+
+	return
+}
+
+func (p *orderedTagPolicy) SelectTag(currentTag string, tags []string) (
+	selectedTag string,
+) {
+	var (
+		current  string
+		key      string
+		matched  bool
+		selected string
+		tag      string
+	)
+
+	selectedTag = currentTag
+
+	// tags outside the pattern, e.g. "latest", are left to digest checks
+	current, matched = p.pattern.key(currentTag)
+	if !matched {
+		return
+	}
+
+	selected = current
+
+	for _, tag = range tags {
+		key, matched = p.pattern.key(tag)
+		if !matched || !p.less(selected, key) {
+			continue
+		}
+
+		selected, selectedTag = key, tag
+	}
+
+	return
+}
+
+type tagPattern struct {
+	expression *regexp.Regexp
+	valid      func(string) bool
+}
+
+func newTagPattern(pattern string) (p *tagPattern, e error) {
+	p = &tagPattern{
+		valid: func(string) bool {
+			return true
+		},
+	}
+
+	// e.g. `^main-(\d{8})-[0-9a-f]+$` for "main-20261017-ab12cd3"
+	p.expression, e = regexp.Compile(pattern)
+	if e != nil {
+		e = errors.NewNotValid(e, pattern)
+
+		return
+	}
+
+	if p.expression.NumSubexp() > 1 {
+		e = errors.NotValidf("pattern %s with more than one capture group",
+			pattern,
+		)
+
+		return
+	}
+
+	return
+}
+
+func (p *tagPattern) match(tag string) (matched bool) {
+	_, matched = p.key(tag)
+
+	return
+}
+
+func (p *tagPattern) key(tag string) (key string, matched bool) {
+	var (
+		submatches []string
+	)
+
+	submatches = p.expression.FindStringSubmatch(tag)
+	if submatches == nil {
+		return
+	}
+
+	// sorted on the capture group if there is one, else on the whole tag
+	if len(submatches) > 1 {
+		key = submatches[1]
+
+	} else {
+		key = tag
+	}
+
+	matched = p.valid(key)
+
+	return
+}
+
+func numberOf(s string) (n *big.Float) {
+	var (
+		ok bool
+	)
+
+	n, ok = new(big.Float).SetString(s)
+	if !ok || n.IsInf() {
+		n = nil
+	}
+
+	return
+}
@@ -0,0 +1,83 @@
+package figwasp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedTagPolicy(t *testing.T) {
+	type testCase struct {
+		newPolicy  func(string) (*orderedTagPolicy, error)
+		pattern    string
+		currentTag string
+		selected   string
+	}
+
+	var (
+		testCases []testCase
+
+		policy *orderedTagPolicy
+		tags   []string
+		test   testCase
+
+		e error
+	)
+
+	tags = []string{
+		"latest", "main-20261016-ff00ee1", "main-20261017-ab12cd3",
+		"feature-20261018-0a1b2c3", "build-9", "build-10", "build-x",
+	}
+
+	testCases = []testCase{
+		{ // sorted on the capture group, not the commit
+			NewAlphabeticalTagPolicy, `^main-(\d{8})-[0-9a-f]+$`,
+			"main-20261016-ff00ee1", "main-20261017-ab12cd3",
+		},
+		{ // already the last
+			NewAlphabeticalTagPolicy, `^main-(\d{8})-[0-9a-f]+$`,
+			"main-20261017-ab12cd3", "main-20261017-ab12cd3",
+		},
+		{ // not within the pattern
+			NewAlphabeticalTagPolicy, `^main-(\d{8})-[0-9a-f]+$`,
+			"latest", "latest",
+		},
+		{ // "build-9" sorts after "build-10" alphabetically
+			NewAlphabeticalTagPolicy, `^build-`,
+			"build-10", "build-x",
+		},
+		{ // but not numerically, and "build-x" is not a number
+			NewNumericalTagPolicy, `^build-(.+)$`,
+			"build-9", "build-10",
+		},
+		{ // never moved back
+			NewNumericalTagPolicy, `^build-(.+)$`,
+			"build-11", "build-11",
+		},
+		{ // the whole tag without a pattern
+			NewAlphabeticalTagPolicy, "",
+			"build-9", "main-20261017-ab12cd3",
+		},
+	}
+
+	for _, test = range testCases {
+		policy, e = test.newPolicy(test.pattern)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t,
+			test.selected,
+			policy.SelectTag(test.currentTag, tags),
+			test.pattern+" from "+test.currentTag,
+		)
+	}
+
+	_, e = NewAlphabeticalTagPolicy("(")
+
+	assert.Error(t, e)
+
+	_, e = NewNumericalTagPolicy(`^(\d+)-(\d+)$`)
+
+	assert.Error(t, e)
+}
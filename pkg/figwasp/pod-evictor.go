@@ -0,0 +1,110 @@
+package figwasp
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	policyV1 "k8s.io/api/policy/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	typedPolicyV1 "k8s.io/client-go/kubernetes/typed/policy/v1"
+	"k8s.io/client-go/rest"
+)
+
+type podEvictor struct {
+	evictions typedPolicyV1.EvictionInterface
+	pods      typedCoreV1.PodInterface
+	namespace string
+	interval  time.Duration
+}
+
+func NewPodEvictor(config *rest.Config, namespace string) (
+	v *podEvictor, e error,
+) {
+	const (
+		interval = time.Second * 2
+	)
+
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	v = &podEvictor{
+		evictions: clientset.PolicyV1().Evictions(namespace),
+		pods:      clientset.CoreV1().Pods(namespace),
+		namespace: namespace,
+		interval:  interval,
+	}
+
+	return
+}
+
+func (v *podEvictor) EvictPod(podName string, ctx context.Context) (
+	refused bool, e error,
+) {
+	e = v.evictions.Evict(ctx,
+		&policyV1.Eviction{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:      podName,
+				Namespace: v.namespace,
+			},
+		},
+	)
+
+	switch {
+	case e == nil:
+
+	case apiErrors.IsTooManyRequests(e):
+		refused = true // so as not to violate a PodDisruptionBudget
+
+		e = nil
+
+	case apiErrors.IsNotFound(e):
+		e = nil // gone already
+
+	default:
+		e = errors.Trace(e)
+	}
+
+	return
+}
+
+func (v *podEvictor) WaitForEviction(podName string, ctx context.Context) (
+	e error,
+) {
+	// until the pod has terminated, and so been replaced
+	e = wait.PollImmediateUntil(v.interval,
+		func() (done bool, e error) {
+			_, e = v.pods.Get(ctx, podName, metaV1.GetOptions{})
+
+			switch {
+			case apiErrors.IsNotFound(e):
+				done, e = true, nil
+
+			case e != nil:
+				e = errors.Trace(e)
+			}
+
+			return
+		},
+		ctx.Done(),
+	)
+	if e != nil {
+		e = errors.Annotatef(e, "eviction of pod %s", podName)
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,240 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/deployments"
+	"github.com/figwasp/figwasp/test/pkg/images"
+	"github.com/figwasp/figwasp/test/pkg/repositories"
+)
+
+func TestPodEvictor(t *testing.T) {
+	var (
+		e error
+	)
+
+	const (
+		dockerHost = "172.17.0.1"
+		localhost  = "127.0.0.1"
+
+		repositoryPort = 5022
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		repository        *repositories.DockerRegistry
+		repositoryAddress net.TCPAddr
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(localhost),
+		creds.WithIPAddress(dockerHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		Port: repositoryPort,
+	}
+
+	repository, e = repositories.NewDockerRegistry(repositoryAddress,
+		repositories.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Destroy()
+
+	const (
+		buildContextPath = "../.."
+		dockerfilePath   = "test/build/idle/Dockerfile"
+		// relative to build context
+
+		imageName      = "idle"
+		imageRefFormat = "%s/%s:%s"
+
+		tag = "1.0.0"
+	)
+
+	var (
+		image                  *images.DockerImage
+		repositoryAddressLocal net.TCPAddr
+	)
+
+	repositoryAddressLocal = net.TCPAddr{
+		IP:   net.ParseIP(localhost),
+		Port: repositoryPort,
+	}
+
+	image, e = images.NewDockerImage(buildContextPath, dockerfilePath,
+		images.WithTag(
+			fmt.Sprintf(imageRefFormat,
+				repositoryAddressLocal.String(),
+				imageName,
+				tag,
+			),
+		),
+		images.WithOutputStream(os.Stderr),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer image.Destroy()
+
+	e = image.Push(os.Stderr)
+	if e != nil {
+		t.Error(e)
+	}
+
+	const (
+		caCertsDir   = "/etc/ssl/certs/test.pem" // kindest/node based on Ubuntu
+		clusterName  = "test-pod-evictor-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+	)
+
+	var (
+		cluster *clusters.KindCluster
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName,
+		clusters.WithExtraMounts(
+			caCertsDir,
+			credential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	const (
+		deploymentName = "deployment"
+		replicas       = 2
+	)
+
+	var (
+		deployment *deployments.KubernetesDeployment
+	)
+
+	deployment, e = deployments.NewKubernetesDeployment(
+		deploymentName,
+		cluster.KubeconfigPath(),
+		deployments.WithReplicas(replicas),
+		deployments.WithContainerWithTCPPorts(imageName,
+			strings.ReplaceAll(
+				fmt.Sprintf(imageRefFormat,
+					repositoryAddressLocal.String(),
+					imageName,
+					tag,
+				),
+				localhost,
+				dockerHost,
+			),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer deployment.Destroy()
+
+	const (
+		masterURL = ""
+	)
+
+	var (
+		config  *rest.Config
+		evictee string
+		refused bool
+		evictor *podEvictor
+		lister  *deploymentPodLister
+		pod     v1.Pod
+		pods    []v1.Pod
+		names   []string
+	)
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	lister, e = NewDeploymentPodLister(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	pods, e = lister.ListPods(deploymentName, context.Background())
+	if e != nil {
+		t.Error(e)
+	}
+
+	if !assert.Len(t, pods, replicas) {
+		return
+	}
+
+	evictor, e = NewPodEvictor(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	evictee = pods[0].Name
+
+	refused, e = evictor.EvictPod(evictee, context.Background())
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.False(t, refused)
+
+	pods, e = lister.ListPods(deploymentName, context.Background())
+	if e != nil {
+		t.Error(e)
+	}
+
+	for _, pod = range pods {
+		if pod.DeletionTimestamp == nil {
+			names = append(names, pod.Name)
+		}
+	}
+
+	assert.NotContains(t, names, evictee)
+
+	e = evictor.WaitForEviction(evictee, context.Background())
+	if e != nil {
+		t.Error(e)
+	}
+
+	// a pod already gone is as good as evicted
+	refused, e = evictor.EvictPod("missing", context.Background())
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.False(t, refused)
+}
@@ -0,0 +1,332 @@
+package figwasp
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/juju/errors"
+	"sigs.k8s.io/yaml"
+)
+
+type registryConfiguration struct {
+	pathToDir string
+	proxies   map[string]*url.URL // by host[:port]
+}
+
+func NewRegistryConfigurationFromFile(pathToConfig string) (
+	c *registryConfiguration, e error,
+) {
+	const (
+		pathToDirParent  = ""
+		pathToDirPattern = "*"
+	)
+
+	var (
+		config   registryConfigurationFile
+		contents []byte
+		registry registryConfigurationEntry
+	)
+
+	contents, e = ioutil.ReadFile(pathToConfig)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	e = yaml.UnmarshalStrict(contents, &config)
+	if e != nil {
+		e = errors.NewNotValid(e, pathToConfig)
+
+		return
+	}
+
+	c = &registryConfiguration{
+		proxies: make(map[string]*url.URL),
+	}
+
+	c.pathToDir, e = ioutil.TempDir(pathToDirParent, pathToDirPattern)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	defer func() {
+		if e != nil {
+			c.Destroy()
+		}
+	}()
+
+	for _, registry = range config.Registries {
+		e = c.addCertificates(registry)
+		if e != nil {
+			e = errors.Annotatef(e, "registry %s", registry.Location)
+
+			return
+		}
+
+		e = c.addProxy(registry)
+		if e != nil {
+			e = errors.Annotatef(e, "registry %s", registry.Location)
+
+			return
+		}
+	}
+
+	e = c.writeRegistriesConfiguration(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (c *registryConfiguration) PathToCertificateDirectory() string {
+	// laid out as "/etc/containers/certs.d", i.e. one directory per host[:port]
+	return filepath.Join(c.pathToDir, "certs.d")
+}
+
+func (c *registryConfiguration) PathToRegistriesConfiguration() string {
+	// in the format of "/etc/containers/registries.conf"
+	return filepath.Join(c.pathToDir, "registries.conf")
+}
+
+func (c *registryConfiguration) Proxies() map[string]*url.URL {
+	return c.proxies
+}
+
+func (c *registryConfiguration) Destroy() (e error) {
+	e = os.RemoveAll(c.pathToDir)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (c *registryConfiguration) addCertificates(
+	registry registryConfigurationEntry,
+) (
+	e error,
+) {
+	const (
+		dirPermission = 0700
+
+		// https://pkg.go.dev/github.com/containers/image/v5/pkg/tlsclientconfig
+		// > a CA certificate ending with ".crt", a client certificate ending
+		// > with ".cert" and its key, of the same name, ending with ".key"
+		caName   = "ca.crt"
+		certName = "client.cert"
+		keyName  = "client.key"
+	)
+
+	var (
+		pathToHostDir string
+		links         map[string]string
+		name          string
+		target        string
+	)
+
+	if registry.Location == "" || filepath.Base(registry.Location) !=
+		registry.Location {
+		e = errors.NotValidf("location %q of host[:port]", registry.Location)
+
+		return
+	}
+
+	if (registry.CertFile == "") != (registry.KeyFile == "") {
+		e = errors.NotValidf("client certificate without key, or vice versa")
+
+		return
+	}
+
+	links = map[string]string{
+		caName:   registry.CAFile,
+		certName: registry.CertFile,
+		keyName:  registry.KeyFile,
+	}
+
+	pathToHostDir = filepath.Join(
+		c.PathToCertificateDirectory(),
+		registry.Location,
+	)
+
+	e = os.MkdirAll(pathToHostDir, dirPermission)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// symbolic links, unlike hard links, may cross into mounted volumes
+	// and follow updates to ConfigMaps and Secrets mounted there
+	for name, target = range links {
+		if target == "" {
+			continue
+		}
+
+		target, e = filepath.Abs(target)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		e = os.Symlink(target,
+			filepath.Join(pathToHostDir, name),
+		)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (c *registryConfiguration) addProxy(
+	registry registryConfigurationEntry,
+) (
+	e error,
+) {
+	var (
+		proxy *url.URL
+	)
+
+	if registry.Proxy == "" {
+		return
+	}
+
+	// the URL, which may hold a password, is left out of errors
+	proxy, e = url.Parse(registry.Proxy)
+	if e != nil || proxyDefaultPorts[proxy.Scheme] == "" ||
+		proxy.Hostname() == "" {
+		e = errors.NotValidf("proxy URL")
+
+		return
+	}
+
+	c.proxies[registry.Location] = proxy
+
+	return
+}
+
+func (c *registryConfiguration) writeRegistriesConfiguration(
+	config registryConfigurationFile,
+) (
+	e error,
+) {
+	const (
+		filePermission = 0600
+	)
+
+	var (
+		conf     registriesConf
+		entry    sysregistriesv2.Registry
+		file     *os.File
+		mirror   registryMirrorEntry
+		registry registryConfigurationEntry
+	)
+
+	for _, registry = range config.Registries {
+		if !registry.insecure() && len(registry.Mirrors) == 0 {
+			continue
+		}
+
+		// containers/image falls back to plain HTTP only for registries
+		// whose certificates it does not verify, and vice versa
+		entry = sysregistriesv2.Registry{
+			Prefix: registry.Location,
+			Endpoint: sysregistriesv2.Endpoint{
+				Location: registry.Location,
+				Insecure: registry.insecure(),
+			},
+		}
+
+		// mirrors are queried in the order given, as by nodes pulling images,
+		// before the registry itself, which is queried only if all fail
+		for _, mirror = range registry.Mirrors {
+			if mirror.Location == "" {
+				e = errors.NotValidf("mirror of registry %s without location",
+					registry.Location,
+				)
+
+				return
+			}
+
+			entry.Mirrors = append(entry.Mirrors,
+				sysregistriesv2.Endpoint{
+					Location: mirror.Location,
+					Insecure: mirror.InsecureSkipVerify || mirror.PlainHTTP,
+				},
+			)
+		}
+
+		conf.Registries = append(conf.Registries, entry)
+	}
+
+	file, e = os.OpenFile(c.PathToRegistriesConfiguration(),
+		os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+		filePermission,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	defer file.Close()
+
+	e = toml.NewEncoder(file).Encode(conf)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+type registryConfigurationFile struct {
+	Registries []registryConfigurationEntry `json:"registries"`
+}
+
+type registryConfigurationEntry struct {
+	Location string `json:"location"` // host[:port]
+
+	CAFile   string `json:"caFile"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+	PlainHTTP          bool `json:"plainHTTP"`
+
+	Mirrors []registryMirrorEntry `json:"mirrors"`
+
+	Proxy string `json:"proxy"` // http[s]://[user:password@]host[:port]
+}
+
+func (r registryConfigurationEntry) insecure() bool {
+	return r.InsecureSkipVerify || r.PlainHTTP
+}
+
+type registryMirrorEntry struct {
+	Location string `json:"location"` // host[:port][/path]
+
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+	PlainHTTP          bool `json:"plainHTTP"`
+}
+
+type registriesConf struct {
+	Registries []sysregistriesv2.Registry `toml:"registry"`
+}
@@ -0,0 +1,406 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/servers"
+)
+
+func TestRegistryConfiguration(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		repositoryPort = 5006
+		plainHTTPPort  = 5007
+
+		imageRefFormat = "%s:%d/configured:latest"
+
+		configFormat = `
+registries:
+- location: %s
+  caFile: %s
+  certFile: %s
+  keyFile: %s
+- location: %s
+  plainHTTP: true
+`
+	)
+
+	var (
+		clientCredential *creds.TLSCertificate
+		serverCredential *creds.TLSCertificate
+
+		repository        *servers.RegistryServer
+		repositoryAddress net.TCPAddr
+		plainHTTP         *servers.RegistryServer
+		plainHTTPAddress  net.TCPAddr
+
+		config       *registryConfiguration
+		directory    string
+		pathToConfig string
+
+		retriever *imageDigestRetriever
+
+		imageDigestString string
+
+		e error
+	)
+
+	serverCredential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithIPAddress(repositoryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer serverCredential.Destroy()
+
+	clientCredential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForClientAuth(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer clientCredential.Destroy()
+
+	repositoryAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: repositoryPort,
+	}
+
+	repository, e = servers.NewRegistryServer(
+		servers.WithTransportLayerSecurity(
+			serverCredential.PathToCertPEM(),
+			serverCredential.PathToKeyPEM(),
+		),
+		servers.WithClientCertificateAuthority(
+			clientCredential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = repository.ServeAtAddress(repositoryAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer repository.Close()
+
+	plainHTTPAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: plainHTTPPort,
+	}
+
+	plainHTTP, e = servers.NewRegistryServer()
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = plainHTTP.ServeAtAddress(plainHTTPAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer plainHTTP.Close()
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	pathToConfig = filepath.Join(directory, "registries.yaml")
+
+	e = ioutil.WriteFile(pathToConfig,
+		[]byte(
+			fmt.Sprintf(configFormat,
+				repositoryAddress.String(),
+				serverCredential.PathToCertPEM(),
+				clientCredential.PathToCertPEM(),
+				clientCredential.PathToKeyPEM(),
+				plainHTTPAddress.String(),
+			),
+		),
+		0600,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	config, e = NewRegistryConfigurationFromFile(pathToConfig)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer config.Destroy()
+
+	// CA and client certificate are presented to the configured registry
+	retriever, e = NewImageDigestRetriever(
+		WithPerHostCertificateDirectory(
+			config.PathToCertificateDirectory(),
+		),
+		WithRegistriesConfiguration(
+			config.PathToRegistriesConfiguration(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	imageDigestString, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, repositoryPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		repository.ManifestDigest(),
+		imageDigestString,
+	)
+
+	imageDigestString, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, plainHTTPPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		plainHTTP.ManifestDigest(),
+		imageDigestString,
+	)
+
+	// neither registry is reachable without configuration
+	retriever, e = NewImageDigestRetriever(
+		WithSelfSignedTLSCertificate(
+			serverCredential.PathToCertPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer retriever.Destroy()
+
+	_, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, repositoryPort),
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+
+	_, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, plainHTTPPort),
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+}
+
+func TestRegistryConfigurationMirrors(t *testing.T) {
+	const (
+		repositoryHost = "127.0.0.1"
+		mirrorPort     = 5008
+		upstreamPort   = 5009
+
+		imageRefFormat = "%s:%d/mirrored:latest"
+
+		configFormat = `
+registries:
+- location: %s
+  plainHTTP: true
+  mirrors:
+  - location: %s
+    plainHTTP: true
+`
+	)
+
+	var (
+		mirror          *servers.RegistryServer
+		mirrorAddress   net.TCPAddr
+		upstream        *servers.RegistryServer
+		upstreamAddress net.TCPAddr
+
+		config       *registryConfiguration
+		directory    string
+		pathToConfig string
+
+		retriever *imageDigestRetriever
+
+		imageDigestString string
+
+		e error
+	)
+
+	mirrorAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: mirrorPort,
+	}
+
+	mirror, e = servers.NewRegistryServer(
+		servers.WithScriptedResponses(
+			servers.ScriptedResponse{},
+			servers.ScriptedResponse{
+				StatusCode: http.StatusServiceUnavailable,
+			},
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = mirror.ServeAtAddress(mirrorAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer mirror.Close()
+
+	upstreamAddress = net.TCPAddr{
+		IP:   net.ParseIP(repositoryHost),
+		Port: upstreamPort,
+	}
+
+	upstream, e = servers.NewRegistryServer()
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = upstream.ServeAtAddress(upstreamAddress)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer upstream.Close()
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	pathToConfig = filepath.Join(directory, "registries.yaml")
+
+	e = ioutil.WriteFile(pathToConfig,
+		[]byte(
+			fmt.Sprintf(configFormat,
+				upstreamAddress.String(),
+				mirrorAddress.String(),
+			),
+		),
+		0600,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	config, e = NewRegistryConfigurationFromFile(pathToConfig)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer config.Destroy()
+
+	retriever, e = NewImageDigestRetriever(
+		WithRegistriesConfiguration(
+			config.PathToRegistriesConfiguration(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	// the mirror is queried in place of the registry
+	imageDigestString, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, upstreamPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		mirror.ManifestDigest(),
+		imageDigestString,
+	)
+
+	assert.Equal(t, 1, mirror.ManifestRequests())
+	assert.Equal(t, 0, upstream.ManifestRequests())
+
+	// the registry is queried if the mirror fails
+	imageDigestString, e = retriever.RetrieveImageDigest(
+		fmt.Sprintf(imageRefFormat, repositoryHost, upstreamPort),
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		upstream.ManifestDigest(),
+		imageDigestString,
+	)
+
+	assert.Equal(t, 2, mirror.ManifestRequests())
+	assert.Equal(t, 1, upstream.ManifestRequests())
+}
+
+func TestRegistryConfigurationValidation(t *testing.T) {
+	var (
+		testCases []string
+
+		directory    string
+		pathToConfig string
+		config       string
+
+		e error
+	)
+
+	testCases = []string{
+		`registries: [{location: "registry.test", certFile: client.cert}]`,
+		`registries: [{location: "registry.test/path"}]`,
+		`registries: [{location: ""}]`,
+		`registries: [{location: "registry.test", unknown: true}]`,
+		`registries: [{location: "registry.test", mirrors: [{location: ""}]}]`,
+		`registries: [{location: "registry.test", proxy: "proxy.test:3128"}]`,
+		`registries: [{location: "registry.test", proxy: "socks5://proxy.test"}]`,
+	}
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	pathToConfig = filepath.Join(directory, "registries.yaml")
+
+	for _, config = range testCases {
+		e = ioutil.WriteFile(pathToConfig, []byte(config), 0600)
+		if e != nil {
+			t.Error(e)
+		}
+
+		_, e = NewRegistryConfigurationFromFile(pathToConfig)
+
+		assert.Error(t, e, config)
+	}
+}
@@ -0,0 +1,194 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"syscall"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+	"github.com/juju/errors"
+)
+
+type RegistryErrorClass int
+
+const (
+	RegistryErrorUnclassified RegistryErrorClass = iota
+	RegistryErrorAuthentication
+	RegistryErrorNotFound
+	RegistryErrorRateLimited
+	RegistryErrorTransient
+)
+
+func (c RegistryErrorClass) Retryable() bool {
+	// github.com/containers/image/v5/docker has already retried queries
+	// rate-limited, honouring Retry-After, so they are not retried again
+	return c == RegistryErrorTransient
+}
+
+func (c RegistryErrorClass) String() string {
+	switch c {
+	case RegistryErrorAuthentication:
+		return "authentication"
+
+	case RegistryErrorNotFound:
+		return "not found"
+
+	case RegistryErrorRateLimited:
+		return "rate limited"
+
+	case RegistryErrorTransient:
+		return "transient"
+
+	default:
+		return "unclassified"
+	}
+}
+
+type RegistryError struct {
+	Class    RegistryErrorClass
+	Attempts int
+	Err      error
+}
+
+func (e *RegistryError) Error() string {
+	const (
+		format = "%s registry error after %d attempt(s): %s"
+	)
+
+	return fmt.Sprintf(format, e.Class, e.Attempts, e.Err)
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+func ClassifyRegistryError(e error) (class RegistryErrorClass) {
+	var (
+		registryError *RegistryError
+
+		errcodeError  errcode.Error
+		errcodeErrors errcode.Errors
+		netError      net.Error
+		statusError   *client.UnexpectedHTTPStatusError
+		unauthorized  docker.ErrUnauthorizedForCredentials
+
+		statusCode int
+	)
+
+	switch {
+	case e == nil:
+		return
+
+	case errors.As(e, &registryError):
+		class = registryError.Class
+
+	case errors.Is(e, context.Canceled),
+		errors.Is(e, context.DeadlineExceeded):
+		class = RegistryErrorUnclassified // the caller has given up
+
+	case errors.As(e, &unauthorized):
+		class = RegistryErrorAuthentication
+
+	case errors.Is(e, docker.ErrTooManyRequests):
+		class = RegistryErrorRateLimited
+
+	case errors.As(e, &errcodeErrors) && len(errcodeErrors) > 0:
+		class = ClassifyRegistryError(errcodeErrors[0])
+
+	case errors.As(e, &errcodeError):
+		class = classifyErrorCode(errcodeError.Code)
+
+	case errors.As(e, &statusError):
+		class = classifyStatusCode(
+			parseStatusCode(statusError.Status),
+		)
+
+	case errors.Is(e, syscall.ECONNRESET),
+		errors.Is(e, syscall.ECONNREFUSED),
+		errors.Is(e, io.ErrUnexpectedEOF),
+		errors.Is(e, io.EOF):
+		class = RegistryErrorTransient
+
+	case errors.As(e, &netError):
+		class = RegistryErrorTransient
+
+	default:
+		statusCode = parseStatusCode(
+			e.Error(),
+		)
+
+		class = classifyStatusCode(statusCode)
+	}
+
+	return
+}
+
+func classifyErrorCode(code errcode.ErrorCode) RegistryErrorClass {
+	switch code {
+	case errcode.ErrorCodeUnauthorized, errcode.ErrorCodeDenied:
+		return RegistryErrorAuthentication
+
+	case v2.ErrorCodeManifestUnknown, v2.ErrorCodeNameUnknown,
+		v2.ErrorCodeBlobUnknown:
+		return RegistryErrorNotFound
+
+	case errcode.ErrorCodeTooManyRequests:
+		return RegistryErrorRateLimited
+
+	case errcode.ErrorCodeUnavailable:
+		return RegistryErrorTransient
+
+	default:
+		return RegistryErrorUnclassified
+	}
+}
+
+func classifyStatusCode(statusCode int) RegistryErrorClass {
+	switch {
+	case statusCode == http.StatusUnauthorized,
+		statusCode == http.StatusForbidden:
+		return RegistryErrorAuthentication
+
+	case statusCode == http.StatusNotFound:
+		return RegistryErrorNotFound
+
+	case statusCode == http.StatusTooManyRequests:
+		return RegistryErrorRateLimited
+
+	case statusCode == http.StatusRequestTimeout,
+		statusCode >= http.StatusInternalServerError:
+		return RegistryErrorTransient
+
+	default:
+		return RegistryErrorUnclassified
+	}
+}
+
+var (
+	statusCodePattern = regexp.MustCompile(
+		`(?:StatusCode: |status code from registry |HTTP status: |^)([1-5]\d\d)\b`,
+	) // formats used by github.com/containers/image/v5/docker
+)
+
+func parseStatusCode(s string) (statusCode int) {
+	var (
+		match []string
+	)
+
+	match = statusCodePattern.FindStringSubmatch(s)
+	if match == nil {
+		return
+	}
+
+	statusCode, _ = strconv.Atoi(match[1])
+
+	return
+}
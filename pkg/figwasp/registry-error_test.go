@@ -0,0 +1,98 @@
+package figwasp
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/client"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyRegistryError(t *testing.T) {
+	type testCase struct {
+		e     error
+		class RegistryErrorClass
+	}
+
+	var (
+		testCases []testCase
+
+		test testCase
+	)
+
+	testCases = []testCase{
+		{
+			docker.ErrUnauthorizedForCredentials{
+				Err: errors.New("invalid username/password"),
+			},
+			RegistryErrorAuthentication,
+		},
+		{
+			errcode.Errors{
+				errcode.ErrorCodeDenied.WithMessage("denied"),
+			},
+			RegistryErrorAuthentication,
+		},
+		{
+			errors.Trace(
+				v2.ErrorCodeManifestUnknown.WithMessage("manifest unknown"),
+			),
+			RegistryErrorNotFound,
+		},
+		{
+			fmt.Errorf("StatusCode: 404, 404 page not found"),
+			RegistryErrorNotFound,
+		},
+		{
+			errors.Annotate(docker.ErrTooManyRequests, "reading manifest"),
+			RegistryErrorRateLimited,
+		},
+		{
+			&client.UnexpectedHTTPStatusError{
+				Status: "503 Service Unavailable",
+			},
+			RegistryErrorTransient,
+		},
+		{
+			errors.New("pinging container registry: " +
+				"invalid status code from registry 502 (Bad Gateway)",
+			),
+			RegistryErrorTransient,
+		},
+		{
+			errors.Trace(syscall.ECONNRESET),
+			RegistryErrorTransient,
+		},
+		{
+			errors.Trace(context.DeadlineExceeded),
+			RegistryErrorUnclassified,
+		},
+		{
+			errors.New("invalid reference format"),
+			RegistryErrorUnclassified,
+		},
+	}
+
+	for _, test = range testCases {
+		assert.Equal(t,
+			test.class,
+			ClassifyRegistryError(test.e),
+			test.e.Error(),
+		)
+
+		assert.Equal(t,
+			test.class,
+			ClassifyRegistryError(
+				errors.Trace(
+					&RegistryError{Class: test.class, Err: test.e},
+				),
+			),
+		)
+	}
+}
@@ -0,0 +1,126 @@
+package figwasp
+
+import (
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+type registryLocation struct {
+	host string
+	port string
+	path string
+}
+
+func newRegistryLocation(s string) (l registryLocation, e error) {
+	const (
+		dockerHubHost = "docker.io"
+
+		pathSeparator = "/"
+		pathV1        = "/v1/"
+		pathV2        = "/v2/"
+
+		portHTTP  = "80"
+		portHTTPS = "443"
+
+		schemeHTTP  = "http://"
+		schemeHTTPS = "https://"
+	)
+
+	var (
+		locator *url.URL
+	)
+
+	if !strings.HasPrefix(s, schemeHTTP) && !strings.HasPrefix(s, schemeHTTPS) {
+		s = schemeHTTPS + s
+	}
+
+	locator, e = url.Parse(s)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if locator.Hostname() == "" {
+		e = errors.NotValidf("registry location %q", s)
+
+		return
+	}
+
+	l = registryLocation{
+		host: strings.ToLower(
+			locator.Hostname(),
+		),
+		port: locator.Port(),
+		path: locator.Path,
+	}
+
+	if locator.Scheme == "https" && l.port == portHTTPS ||
+		locator.Scheme == "http" && l.port == portHTTP {
+		l.port = "" // default
+	}
+
+	switch l.host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		l.host = dockerHubHost
+	}
+
+	// Docker considers paths "/v1/" and "/v2/" equivalent to none
+	if strings.HasPrefix(l.path, pathV1) || strings.HasPrefix(l.path, pathV2) {
+		l.path = l.path[len(pathV1)-1:]
+	}
+
+	l.path = strings.TrimSuffix(l.path, pathSeparator)
+
+	return
+}
+
+func (l registryLocation) String() (s string) {
+	s = l.host
+
+	if l.port != "" {
+		s = net.JoinHostPort(s, l.port)
+	}
+
+	s += l.path
+
+	return
+}
+
+func (l registryLocation) Matches(target registryLocation) (matches bool) {
+	// as in kubelet, host labels of l may contain wildcards e.g. "*.example.com"
+	// and the path of l must be a prefix of that of target
+	const (
+		labelSeparator = "."
+	)
+
+	var (
+		labels       []string
+		labelsTarget []string
+
+		i int
+	)
+
+	labels = strings.Split(l.host, labelSeparator)
+	labelsTarget = strings.Split(target.host, labelSeparator)
+
+	if len(labels) != len(labelsTarget) {
+		return
+	}
+
+	for i = range labels {
+		matches, _ = filepath.Match(labels[i], labelsTarget[i])
+		if !matches {
+			return
+		}
+	}
+
+	matches = l.port == target.port &&
+		strings.HasPrefix(target.path, l.path)
+
+	return
+}
@@ -0,0 +1,95 @@
+package figwasp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryLocation(t *testing.T) {
+	var (
+		testCases map[string]string
+
+		location registryLocation
+
+		expected string
+		s        string
+
+		e error
+	)
+
+	testCases = map[string]string{
+		"myreg:5000":                  "myreg:5000",
+		"https://myreg:5000":          "myreg:5000",
+		"http://myreg:5000/":          "myreg:5000",
+		"myreg:5000/path":             "myreg:5000/path",
+		"https://myreg:5000/v2/path/": "myreg:5000/path",
+		"https://MyReg.example.com":   "myreg.example.com",
+		"https://myreg:443":           "myreg",
+		"http://myreg:80":             "myreg",
+		"https://myreg:80":            "myreg:80",
+		"https://index.docker.io/v1/": "docker.io",
+		"index.docker.io":             "docker.io",
+		"registry-1.docker.io":        "docker.io",
+		"docker.io/library/busybox":   "docker.io/library/busybox",
+		"*.example.com":               "*.example.com",
+	}
+
+	for s, expected = range testCases {
+		location, e = newRegistryLocation(s)
+		if e != nil {
+			t.Error(s, e)
+		}
+
+		assert.Equal(t, expected, location.String(), s)
+	}
+}
+
+func TestRegistryLocationMatches(t *testing.T) {
+	type testCase struct {
+		pattern string
+		target  string
+		matches bool
+	}
+
+	var (
+		testCases []testCase
+
+		pattern registryLocation
+		target  registryLocation
+		test    testCase
+
+		e error
+	)
+
+	testCases = []testCase{
+		{"myreg:5000", "myreg:5000/repo", true},
+		{"myreg:5000", "myreg:5001/repo", false},
+		{"myreg:5000", "myreg/repo", false},
+		{"myreg:5000/team", "myreg:5000/team/repo", true},
+		{"myreg:5000/team", "myreg:5000/other/repo", false},
+		{"*.example.com", "reg.example.com/repo", true},
+		{"*.example.com", "example.com/repo", false},
+		{"*.example.com", "a.reg.example.com/repo", false},
+		{"reg.*.com", "reg.example.com/repo", true},
+		{"https://index.docker.io/v1/", "docker.io/library/busybox", true},
+	}
+
+	for _, test = range testCases {
+		pattern, e = newRegistryLocation(test.pattern)
+		if e != nil {
+			t.Error(e)
+		}
+
+		target, e = newRegistryLocation(test.target)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t,
+			test.matches,
+			pattern.Matches(target),
+			test.pattern+" "+test.target,
+		)
+	}
+}
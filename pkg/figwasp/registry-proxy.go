@@ -0,0 +1,308 @@
+package figwasp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/juju/errors"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	proxySchemeHTTP  = "http"
+	proxySchemeHTTPS = "https"
+)
+
+var (
+	proxyDefaultPorts = map[string]string{
+		proxySchemeHTTP:  "80",
+		proxySchemeHTTPS: "443",
+	}
+)
+
+type registryProxy struct {
+	forwarder *httputil.ReverseProxy
+	listener  net.Listener
+	server    *http.Server
+
+	proxies              map[string]*url.URL // by registry host[:port]
+	proxyFromEnvironment func(*url.URL) (*url.URL, error)
+}
+
+func NewRegistryProxy(proxies map[string]*url.URL) (
+	p *registryProxy, e error,
+) {
+	const (
+		network = "tcp"
+		address = "127.0.0.1:0"
+	)
+
+	p = &registryProxy{
+		proxies: proxies,
+
+		// read now, before the environment is pointed at this proxy
+		proxyFromEnvironment: httpproxy.FromEnvironment().ProxyFunc(),
+	}
+
+	p.forwarder = &httputil.ReverseProxy{
+		Director: func(*http.Request) {}, // requests bear absolute URLs
+		Transport: &http.Transport{
+			Proxy: func(request *http.Request) (*url.URL, error) {
+				return p.proxy(request.URL)
+			},
+		},
+	}
+
+	p.server = &http.Server{
+		Handler: p,
+	}
+
+	p.listener, e = net.Listen(network, address)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	go p.server.Serve(p.listener)
+
+	return
+}
+
+func (p *registryProxy) URL() string {
+	return (&url.URL{
+		Scheme: proxySchemeHTTP,
+		Host:   p.listener.Addr().String(),
+	}).String()
+}
+
+func (p *registryProxy) Close() (e error) {
+	e = p.server.Close()
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (p *registryProxy) ServeHTTP(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	// HTTPS is tunnelled with CONNECT; plain HTTP is forwarded as is
+	if request.Method != http.MethodConnect {
+		p.forwarder.ServeHTTP(writer, request)
+
+		return
+	}
+
+	p.tunnel(writer, request)
+}
+
+func (p *registryProxy) tunnel(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		established = "HTTP/1.1 200 Connection established\r\n\r\n"
+	)
+
+	var (
+		buffered *bufio.ReadWriter
+		client   net.Conn
+		server   net.Conn
+
+		e error
+	)
+
+	server, e = p.dial(request.Context(), request.Host)
+	if e != nil {
+		http.Error(writer, e.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	client, buffered, e = writer.(http.Hijacker).Hijack()
+	if e != nil {
+		server.Close()
+
+		http.Error(writer, e.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	buffered.WriteString(established)
+
+	buffered.Flush()
+
+	go func() {
+		io.Copy(server, buffered)
+
+		server.Close()
+	}()
+
+	io.Copy(client, server)
+
+	client.Close()
+}
+
+func (p *registryProxy) dial(ctx context.Context, target string) (
+	conn net.Conn, e error,
+) {
+	const (
+		network = "tcp"
+
+		proxyAuthorizationKey    = "Proxy-Authorization"
+		proxyAuthorizationPrefix = "Basic "
+	)
+
+	var (
+		connect  *http.Request
+		dialer   net.Dialer
+		password string
+		proxy    *url.URL
+		response *http.Response
+	)
+
+	proxy, e = p.proxy(
+		&url.URL{
+			Scheme: proxySchemeHTTPS,
+			Host:   target,
+		},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if proxy == nil {
+		conn, e = dialer.DialContext(ctx, network, target)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		return
+	}
+
+	conn, e = dialer.DialContext(ctx, network,
+		net.JoinHostPort(
+			proxy.Hostname(),
+			proxyPort(proxy),
+		),
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	defer func() {
+		if e != nil {
+			conn.Close()
+		}
+	}()
+
+	if proxy.Scheme == proxySchemeHTTPS {
+		conn = tls.Client(conn,
+			&tls.Config{
+				ServerName: proxy.Hostname(),
+			},
+		)
+	}
+
+	connect = &http.Request{
+		Method: http.MethodConnect,
+		URL: &url.URL{
+			Opaque: target,
+		},
+		Host:   target,
+		Header: make(http.Header),
+	}
+
+	if proxy.User != nil {
+		password, _ = proxy.User.Password()
+
+		connect.Header.Set(proxyAuthorizationKey,
+			proxyAuthorizationPrefix+base64.StdEncoding.EncodeToString(
+				[]byte(proxy.User.Username()+":"+password),
+			),
+		)
+	}
+
+	e = connect.Write(conn)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// nothing follows the response before the client speaks,
+	// as TLS clients speak first, so the reader may be discarded
+	response, e = http.ReadResponse(
+		bufio.NewReader(conn),
+		connect,
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		e = errors.Errorf("proxy %s: %s", proxy.Host, response.Status)
+
+		return
+	}
+
+	return
+}
+
+func (p *registryProxy) proxy(target *url.URL) (proxy *url.URL, e error) {
+	var (
+		found bool
+	)
+
+	proxy, found = p.proxies[target.Host]
+	if found {
+		return
+	}
+
+	// a location without port stands for the default port, as in image names
+	if target.Port() == "" || target.Port() == proxyDefaultPorts[target.Scheme] {
+		proxy, found = p.proxies[target.Hostname()]
+		if found {
+			return
+		}
+	}
+
+	// registries without proxies of their own, and other traffic,
+	// are subject to HTTPS_PROXY, HTTP_PROXY and NO_PROXY as before
+	proxy, e = p.proxyFromEnvironment(target)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func proxyPort(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Port()
+	}
+
+	return proxyDefaultPorts[proxy.Scheme]
+}
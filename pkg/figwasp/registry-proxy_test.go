@@ -0,0 +1,385 @@
+package figwasp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	creds "github.com/figwasp/figwasp/test/pkg/credentials"
+	"github.com/figwasp/figwasp/test/pkg/servers"
+)
+
+func TestRegistryProxy(t *testing.T) {
+	const (
+		localHost = "127.0.0.1"
+
+		// resolved only by the forward proxies
+		registryHost = "registry.figwasp.test"
+		excludedHost = "excluded.figwasp.test"
+
+		plainHTTPPort     = 5010
+		tlsPort           = 5011
+		explicitProxyPort = 5012
+		envProxyPort      = 5013
+
+		endpointFormat = "%s://%s:%d/v2/"
+	)
+
+	var (
+		credential *creds.TLSCertificate
+
+		plainHTTP *servers.RegistryServer
+		tlsServer *servers.RegistryServer
+
+		explicitProxy    *servers.ForwardProxyServer
+		explicitProxyURL *url.URL
+		envProxy         *servers.ForwardProxyServer
+		envProxyURL      *url.URL
+
+		proxy *registryProxy
+
+		caCertPEM []byte
+		client    *http.Client
+		pool      *x509.CertPool
+		routerURL *url.URL
+		response  *http.Response
+
+		e error
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithDNSName(registryHost),
+		creds.WithDNSName(excludedHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	plainHTTP, e = servers.NewRegistryServer()
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = plainHTTP.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: plainHTTPPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer plainHTTP.Close()
+
+	tlsServer, e = servers.NewRegistryServer(
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = tlsServer.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: tlsPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer tlsServer.Close()
+
+	explicitProxy, e = servers.NewForwardProxyServer(
+		servers.WithHostAlias(registryHost, localHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = explicitProxy.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: explicitProxyPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer explicitProxy.Close()
+
+	envProxy, e = servers.NewForwardProxyServer(
+		servers.WithHostAlias(registryHost, localHost),
+		servers.WithHostAlias(excludedHost, localHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = envProxy.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: envProxyPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer envProxy.Close()
+
+	explicitProxyURL = &url.URL{
+		Scheme: proxySchemeHTTP,
+		Host:   fmt.Sprintf("%s:%d", localHost, explicitProxyPort),
+	}
+
+	envProxyURL = &url.URL{
+		Scheme: proxySchemeHTTP,
+		Host:   fmt.Sprintf("%s:%d", localHost, envProxyPort),
+	}
+
+	t.Setenv("HTTP_PROXY", envProxyURL.String())
+	t.Setenv("HTTPS_PROXY", envProxyURL.String())
+	t.Setenv("NO_PROXY", excludedHost)
+
+	proxy, e = NewRegistryProxy(
+		map[string]*url.URL{
+			fmt.Sprintf("%s:%d", registryHost, plainHTTPPort): explicitProxyURL,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer proxy.Close()
+
+	routerURL, e = url.Parse(
+		proxy.URL(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	caCertPEM, e = ioutil.ReadFile(
+		credential.PathToCertPEM(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	pool = x509.NewCertPool()
+
+	pool.AppendCertsFromPEM(caCertPEM)
+
+	// as containers/image is pointed at the proxy through the environment
+	client = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(routerURL),
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}
+
+	// the registry's own proxy is used
+	response, e = client.Get(
+		fmt.Sprintf(endpointFormat,
+			proxySchemeHTTP,
+			registryHost,
+			plainHTTPPort,
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 1, explicitProxy.Requests())
+	assert.Equal(t, 0, envProxy.Requests())
+
+	// other registries are tunnelled through HTTPS_PROXY
+	response, e = client.Get(
+		fmt.Sprintf(endpointFormat,
+			proxySchemeHTTPS,
+			registryHost,
+			tlsPort,
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 1, explicitProxy.Requests())
+	assert.Equal(t, 1, envProxy.Requests())
+
+	// and those in NO_PROXY are dialled directly, unresolvable here
+	_, e = client.Get(
+		fmt.Sprintf(endpointFormat,
+			proxySchemeHTTPS,
+			excludedHost,
+			tlsPort,
+		),
+	)
+
+	assert.Error(t, e)
+	assert.Equal(t, 1, explicitProxy.Requests())
+	assert.Equal(t, 1, envProxy.Requests())
+}
+
+func TestRegistryProxyEndToEnd(t *testing.T) {
+	const (
+		localHost    = "127.0.0.1"
+		registryHost = "registry.figwasp.test"
+
+		registryPort = 5014
+		proxyPort    = 5015
+
+		imageRefFormat = "%s:%d/proxied:latest"
+
+		retrieverName       = "image-digest-retriever"
+		retrieverSourcePath = "../../test/cmd/image-digest-retriever"
+	)
+
+	var (
+		credential *creds.TLSCertificate
+		registry   *servers.RegistryServer
+		upstream   *servers.ForwardProxyServer
+		proxy      *registryProxy
+
+		command   *exec.Cmd
+		directory string
+		output    []byte
+
+		e error
+	)
+
+	credential, e = creds.NewTLSCertificate(
+		creds.WithExtendedKeyUsageForServerAuth(),
+		creds.WithDNSName(registryHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer credential.Destroy()
+
+	registry, e = servers.NewRegistryServer(
+		servers.WithTransportLayerSecurity(
+			credential.PathToCertPEM(),
+			credential.PathToKeyPEM(),
+		),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = registry.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: registryPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer registry.Close()
+
+	upstream, e = servers.NewForwardProxyServer(
+		servers.WithHostAlias(registryHost, localHost),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	e = upstream.ServeAtAddress(
+		net.TCPAddr{
+			IP:   net.ParseIP(localHost),
+			Port: proxyPort,
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer upstream.Close()
+
+	proxy, e = NewRegistryProxy(
+		map[string]*url.URL{
+			fmt.Sprintf("%s:%d", registryHost, registryPort): {
+				Scheme: proxySchemeHTTP,
+				Host:   fmt.Sprintf("%s:%d", localHost, proxyPort),
+			},
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer proxy.Close()
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	e = exec.Command("go", "build",
+		"-o", filepath.Join(directory, retrieverName),
+		retrieverSourcePath,
+	).Run()
+	if e != nil {
+		t.Error(e)
+	}
+
+	// the environment is pointed at the proxy, as by Figwasp,
+	// in a process of its own as it is read once per process
+	command = exec.Command(
+		filepath.Join(directory, retrieverName),
+		fmt.Sprintf(imageRefFormat, registryHost, registryPort),
+		credential.PathToCertPEM(),
+	)
+
+	command.Env = append(os.Environ(),
+		"HTTPS_PROXY="+proxy.URL(),
+		"HTTP_PROXY="+proxy.URL(),
+		"NO_PROXY=",
+	)
+
+	output, e = command.Output()
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		registry.ManifestDigest(),
+		string(output),
+	)
+
+	assert.Equal(t, 1, registry.ManifestRequests())
+	assert.NotZero(t, upstream.Requests())
+}
@@ -1,15 +1,18 @@
 package figwasp
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
 
 	"github.com/juju/errors"
 	"k8s.io/api/core/v1"
-	"k8s.io/kubectl/pkg/cmd/create"
 )
 
 type repositoryCredentialsGetter struct {
-	store map[string]credentials
+	index []credentialsEntry
 }
 
 func NewRepositoryCredentialsGetterFromKubernetesSecrets(secrets []v1.Secret) (
@@ -18,57 +21,218 @@ func NewRepositoryCredentialsGetterFromKubernetesSecrets(secrets []v1.Secret) (
 	var (
 		secret v1.Secret
 
-		dockerConfig      create.DockerConfigJSON
-		dockerConfigEntry create.DockerConfigEntry
-		repositoryAddress string
+		config     dockerConfig
+		configJSON dockerConfigJSON
+
+		i int
 	)
 
-	g = &repositoryCredentialsGetter{
-		store: make(map[string]credentials),
-	}
+	g = &repositoryCredentialsGetter{}
+
+	for i, secret = range secrets {
+		config, configJSON = nil, dockerConfigJSON{}
+		// json.Unmarshal would otherwise merge into maps of previous secrets
+
+		switch secret.Type {
+		case v1.SecretTypeDockerConfigJson:
+			e = json.Unmarshal(
+				secret.Data[v1.DockerConfigJsonKey],
+				&configJSON,
+			)
+			if e != nil {
+				e = errors.Trace(e)
+
+				return
+			}
+
+			config = configJSON.Auths
+
+		case v1.SecretTypeDockercfg: // legacy format without "auths" wrapper
+			e = json.Unmarshal(
+				secret.Data[v1.DockerConfigKey],
+				&config,
+			)
+			if e != nil {
+				e = errors.Trace(e)
 
-	for _, secret = range secrets {
-		if secret.Type != v1.SecretTypeDockerConfigJson {
+				return
+			}
+
+		default:
 			continue
 		}
 
-		e = json.Unmarshal(
-			secret.Data[v1.DockerConfigJsonKey],
-			&dockerConfig,
-		)
+		e = g.addDockerConfig(config, i)
 		if e != nil {
-			e = errors.Trace(e)
+			e = errors.Annotatef(e, "secret %s", secret.Name)
 
 			return
 		}
+	}
 
-		for repositoryAddress, dockerConfigEntry = range dockerConfig.Auths {
-			g.store[repositoryAddress] = credentials{
-				username: dockerConfigEntry.Username,
-				password: dockerConfigEntry.Password,
-			}
+	g.sortIndex()
+
+	return
+}
+
+func NewRepositoryCredentialsGetterFromDockerConfigFile(pathToConfig string) (
+	g *repositoryCredentialsGetter, e error,
+) {
+	var (
+		contents []byte
+
+		config     dockerConfig
+		configJSON dockerConfigJSON
+	)
+
+	contents, e = ioutil.ReadFile(pathToConfig)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// as in kubelet, "config.json" is read for "auths" and,
+	// lacking those, as a legacy ".dockercfg"
+	e = json.Unmarshal(contents, &configJSON)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	config = configJSON.Auths
+
+	if config == nil {
+		e = json.Unmarshal(contents, &config)
+		if e != nil {
+			e = errors.NewNotValid(e, pathToConfig)
+
+			return
 		}
 	}
 
+	g = &repositoryCredentialsGetter{}
+
+	e = g.addDockerConfig(config, 0)
+	if e != nil {
+		e = errors.Annotatef(e, "file %s", pathToConfig)
+
+		return
+	}
+
+	g.sortIndex()
+
 	return
 }
 
 func (g *repositoryCredentialsGetter) GetRepositoryCredentials(
-	repositoryAddress string,
+	repositoryName string,
 ) (
 	username, password string,
 ) {
 	var (
-		entry credentials
-		found bool
+		entry credentialsEntry
 	)
 
-	entry, found = g.store[repositoryAddress]
-	if !found {
+	entry = g.match(repositoryName)
+
+	username, password = entry.username, entry.password
+
+	return
+}
+
+func (g *repositoryCredentialsGetter) GetRepositoryTokens(
+	repositoryName string,
+) (
+	identityToken, registryToken string,
+) {
+	var (
+		entry credentialsEntry
+	)
+
+	entry = g.match(repositoryName)
+
+	identityToken, registryToken = entry.identityToken, entry.registryToken
+
+	return
+}
+
+func (g *repositoryCredentialsGetter) match(repositoryName string) (
+	entry credentialsEntry,
+) {
+	var (
+		target registryLocation
+
+		e error
+	)
+
+	target, e = newRegistryLocation(repositoryName)
+	if e != nil {
 		return
 	}
 
-	username, password = entry.username, entry.password
+	for _, entry = range g.index {
+		if entry.location.Matches(target) {
+			return
+		}
+	}
+
+	entry = credentialsEntry{}
+
+	return
+}
+
+func (g *repositoryCredentialsGetter) addDockerConfig(
+	dockerConfig dockerConfig, secretIndex int,
+) (
+	e error,
+) {
+	var (
+		dockerConfigEntry dockerConfigEntry
+		entry             credentialsEntry
+		repositoryAddress string
+	)
+
+	for repositoryAddress, dockerConfigEntry = range dockerConfig {
+		entry = credentialsEntry{
+			secretIndex: secretIndex,
+		}
+
+		entry.location, e = newRegistryLocation(repositoryAddress)
+		if e != nil {
+			e = errors.Annotatef(e, "entry for %s", repositoryAddress)
+
+			return
+		}
+
+		entry.credentials, e =
+			newCredentialsFromDockerConfigEntry(dockerConfigEntry)
+		if e != nil {
+			e = errors.Annotatef(e, "entry for %s", repositoryAddress)
+
+			return
+		}
+
+		g.index = append(g.index, entry)
+	}
+
+	return
+}
+
+func (g *repositoryCredentialsGetter) sortIndex() {
+	// as in kubelet, secrets are consulted in the order given and,
+	// within a secret, more specific paths are matched first
+	// e.g. "quay.io/coreos" before "quay.io"
+	sort.SliceStable(g.index,
+		func(i, j int) bool {
+			if g.index[i].secretIndex != g.index[j].secretIndex {
+				return g.index[i].secretIndex < g.index[j].secretIndex
+			}
+
+			return g.index[i].location.String() > g.index[j].location.String()
+		},
+	)
 
 	return
 }
@@ -76,4 +240,79 @@ func (g *repositoryCredentialsGetter) GetRepositoryCredentials(
 type credentials struct {
 	username string
 	password string
+
+	identityToken string
+	registryToken string
+}
+
+type credentialsEntry struct {
+	credentials
+
+	location    registryLocation
+	secretIndex int
+}
+
+func newCredentialsFromDockerConfigEntry(entry dockerConfigEntry) (
+	c credentials, e error,
+) {
+	const (
+		separator = ":"
+	)
+
+	var (
+		auth  []byte
+		parts []string
+	)
+
+	c = credentials{
+		username: entry.Username,
+		password: entry.Password,
+
+		identityToken: entry.IdentityToken,
+		registryToken: entry.RegistryToken,
+	}
+
+	if entry.Auth == "" {
+		return
+	}
+
+	// "auth" takes precedence over "username" and "password", as in kubelet
+	auth, e = base64.StdEncoding.DecodeString(entry.Auth)
+	if e != nil {
+		e = errors.NewNotValid(e, "auth")
+
+		return
+	}
+
+	parts = strings.SplitN(
+		string(auth),
+		separator,
+		2,
+	)
+	if len(parts) != 2 {
+		e = errors.NotValidf("auth without separator %q", separator)
+
+		return
+	}
+
+	c.username, c.password = parts[0], parts[1]
+
+	return
+}
+
+type dockerConfigJSON struct {
+	Auths dockerConfig `json:"auths"`
+}
+
+type dockerConfig map[string]dockerConfigEntry
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+
+	// as written by "docker login" to registries issuing tokens
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
 }
@@ -2,6 +2,9 @@ package figwasp
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -111,3 +114,404 @@ func TestRepositoryCredentialsGetter(t *testing.T) {
 		assert.Equal(t, passwords[i], password)
 	}
 }
+
+func TestRepositoryCredentialsGetterSecretFormats(t *testing.T) {
+	const (
+		address  = "127.0.0.1:5000"
+		username = "username"
+		password = "pass:word" // separator in password must be preserved
+
+		auth = "dXNlcm5hbWU6cGFzczp3b3Jk" // base64 of "username:pass:word"
+	)
+
+	type testCase struct {
+		secret v1.Secret
+
+		username string
+		password string
+		invalid  bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		getter *repositoryCredentialsGetter
+
+		name string
+		test testCase
+
+		passwordActual string
+		usernameActual string
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"dockerconfigjson with username and password": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(`{"auths":{"` + address +
+						`":{"username":"` + username +
+						`","password":"` + password + `"}}}`,
+					),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			username: username,
+			password: password,
+		},
+		"dockerconfigjson with auth only": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(`{"auths":{"` + address +
+						`":{"auth":"` + auth + `"}}}`,
+					),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			username: username,
+			password: password,
+		},
+		"dockerconfigjson with auth overriding username and password": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(`{"auths":{"` + address +
+						`":{"username":"other","password":"other",` +
+						`"auth":"` + auth + `"}}}`,
+					),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			username: username,
+			password: password,
+		},
+		"dockercfg with auth": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigKey: []byte(`{"` + address +
+						`":{"auth":"` + auth + `","email":"a@b.c"}}`,
+					),
+				},
+				Type: v1.SecretTypeDockercfg,
+			},
+			username: username,
+			password: password,
+		},
+		"dockercfg with username and password": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigKey: []byte(`{"` + address +
+						`":{"username":"` + username +
+						`","password":"` + password + `"}}`,
+					),
+				},
+				Type: v1.SecretTypeDockercfg,
+			},
+			username: username,
+			password: password,
+		},
+		"auth not in base64": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(`{"auths":{"` + address +
+						`":{"auth":"%%%"}}}`,
+					),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			invalid: true,
+		},
+		"auth without separator": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(`{"auths":{"` + address +
+						`":{"auth":"dXNlcm5hbWU="}}}`, // "username"
+					),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			invalid: true,
+		},
+		"opaque secret ignored": {
+			secret: v1.Secret{
+				Data: map[string][]byte{
+					v1.DockerConfigKey: []byte(`{"` + address +
+						`":{"auth":"` + auth + `"}}`,
+					),
+				},
+				Type: v1.SecretTypeOpaque,
+			},
+		},
+	}
+
+	for name, test = range testCases {
+		getter, e = NewRepositoryCredentialsGetterFromKubernetesSecrets(
+			[]v1.Secret{test.secret},
+		)
+
+		if test.invalid {
+			assert.Error(t, e, name)
+
+			continue
+		}
+
+		if e != nil {
+			t.Error(name, e)
+
+			continue
+		}
+
+		usernameActual, passwordActual = getter.GetRepositoryCredentials(
+			address,
+		)
+
+		assert.Equal(t, test.username, usernameActual, name)
+		assert.Equal(t, test.password, passwordActual, name)
+	}
+}
+
+func TestRepositoryCredentialsGetterMatching(t *testing.T) {
+	const (
+		dockerConfigJSON = `{"auths":{` +
+			`"https://index.docker.io/v1/":{"username":"hub","password":"0"},` +
+			`"https://myreg:5000":{"username":"myreg","password":"1"},` +
+			`"myreg:5000/team":{"username":"team","password":"2"},` +
+			`"*.example.com":{"username":"wildcard","password":"3"},` +
+			`"https://reg.example.com:443/v2/":{"username":"exact","password":"4"}` +
+			`}}`
+	)
+
+	var (
+		testCases map[string]string
+
+		getter *repositoryCredentialsGetter
+
+		repositoryName   string
+		usernameExpected string
+		usernameActual   string
+
+		e error
+	)
+
+	testCases = map[string]string{
+		"docker.io/library/busybox":    "hub",
+		"myreg:5000/repo":              "myreg",
+		"myreg:5000/team/repo":         "team",
+		"myreg:5000/teammate/repo":     "team", // prefix match as in kubelet
+		"other.example.com/repo":       "wildcard",
+		"reg.example.com/repo":         "exact",
+		"myreg/repo":                   "",
+		"deeper.reg.example.com/repo":  "",
+		"quay.io/coreos/etcd-operator": "",
+	}
+
+	getter, e = NewRepositoryCredentialsGetterFromKubernetesSecrets(
+		[]v1.Secret{
+			{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(dockerConfigJSON),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	for repositoryName, usernameExpected = range testCases {
+		usernameActual, _ = getter.GetRepositoryCredentials(repositoryName)
+
+		assert.Equal(t, usernameExpected, usernameActual, repositoryName)
+	}
+}
+
+func TestRepositoryCredentialsGetterSecretOrder(t *testing.T) {
+	const (
+		dockerConfigJSON0 = `{"auths":{` +
+			`"myreg:5000":{"username":"first","password":"0"}` +
+			`}}`
+		dockerConfigJSON1 = `{"auths":{` +
+			`"myreg:5000/team":{"username":"second","password":"1"},` +
+			`"other:5000":{"username":"second","password":"1"}` +
+			`}}`
+	)
+
+	var (
+		getter *repositoryCredentialsGetter
+
+		username string
+
+		e error
+	)
+
+	// as in kubelet, the first secret listed by the workload takes precedence
+	// over any later secret, however specific the later entry
+	getter, e = NewRepositoryCredentialsGetterFromKubernetesSecrets(
+		[]v1.Secret{
+			{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(dockerConfigJSON0),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+			{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(dockerConfigJSON1),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	username, _ = getter.GetRepositoryCredentials("myreg:5000/team/repo")
+
+	assert.Equal(t, "first", username)
+
+	username, _ = getter.GetRepositoryCredentials("other:5000/repo")
+
+	assert.Equal(t, "second", username)
+}
+
+func TestRepositoryCredentialsGetterTokens(t *testing.T) {
+	const (
+		dockerConfigJSON = `{"auths":{` +
+			`"identity.test":{"username":"<token>","identitytoken":"identity"},` +
+			`"registry.test":{"registrytoken":"registry"}` +
+			`}}`
+	)
+
+	var (
+		getter *repositoryCredentialsGetter
+
+		identityToken string
+		registryToken string
+		username      string
+
+		e error
+	)
+
+	getter, e = NewRepositoryCredentialsGetterFromKubernetesSecrets(
+		[]v1.Secret{
+			{
+				Data: map[string][]byte{
+					v1.DockerConfigJsonKey: []byte(dockerConfigJSON),
+				},
+				Type: v1.SecretTypeDockerConfigJson,
+			},
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	username, _ = getter.GetRepositoryCredentials("identity.test/repo")
+
+	identityToken, registryToken = getter.GetRepositoryTokens(
+		"identity.test/repo",
+	)
+
+	assert.Equal(t, "<token>", username)
+	assert.Equal(t, "identity", identityToken)
+	assert.Empty(t, registryToken)
+
+	identityToken, registryToken = getter.GetRepositoryTokens(
+		"registry.test/repo",
+	)
+
+	assert.Empty(t, identityToken)
+	assert.Equal(t, "registry", registryToken)
+
+	identityToken, registryToken = getter.GetRepositoryTokens(
+		"other.test/repo",
+	)
+
+	assert.Empty(t, identityToken)
+	assert.Empty(t, registryToken)
+}
+
+func TestRepositoryCredentialsGetterFromDockerConfigFile(t *testing.T) {
+	type testCase struct {
+		contents string
+
+		username string
+		valid    bool
+	}
+
+	var (
+		testCases map[string]testCase
+
+		directory    string
+		pathToConfig string
+
+		getter *repositoryCredentialsGetter
+
+		name     string
+		test     testCase
+		username string
+
+		e error
+	)
+
+	testCases = map[string]testCase{
+		"config.json": {
+			contents: `{"auths":{"registry.test":{"auth":"dXNlcjpwYXNz"}},` +
+				`"HttpHeaders":{"User-Agent":"Docker-Client"}}`,
+			username: "user",
+			valid:    true,
+		},
+		"legacy .dockercfg": {
+			contents: `{"registry.test":{"username":"legacy","password":"p"}}`,
+			username: "legacy",
+			valid:    true,
+		},
+		"credential store only": {
+			contents: `{"credsStore":"desktop"}`,
+		},
+		"malformed": {
+			contents: `{`,
+		},
+	}
+
+	directory, e = ioutil.TempDir("", "")
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer os.RemoveAll(directory)
+
+	pathToConfig = filepath.Join(directory, "config.json")
+
+	for name, test = range testCases {
+		e = ioutil.WriteFile(pathToConfig, []byte(test.contents), 0600)
+		if e != nil {
+			t.Error(e)
+		}
+
+		getter, e = NewRepositoryCredentialsGetterFromDockerConfigFile(
+			pathToConfig,
+		)
+		if !test.valid {
+			assert.Error(t, e, name)
+
+			continue
+		}
+
+		if e != nil {
+			t.Error(e)
+		}
+
+		username, _ = getter.GetRepositoryCredentials("registry.test/repo")
+
+		assert.Equal(t, test.username, username, name)
+	}
+
+	_, e = NewRepositoryCredentialsGetterFromDockerConfigFile(
+		filepath.Join(directory, "missing.json"),
+	)
+
+	assert.Error(t, e)
+}
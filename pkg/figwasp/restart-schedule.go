@@ -0,0 +1,376 @@
+package figwasp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	restartScheduleSeparator = ";"
+	restartScheduleDate      = "2006-01-02"
+)
+
+var (
+	restartScheduleWeekdays = map[string]time.Weekday{
+		"Sun": time.Sunday,
+		"Mon": time.Monday,
+		"Tue": time.Tuesday,
+		"Wed": time.Wednesday,
+		"Thu": time.Thursday,
+		"Fri": time.Friday,
+		"Sat": time.Saturday,
+	}
+)
+
+type restartSchedule struct {
+	blackouts []restartBlackout
+	location  *time.Location
+	windows   []restartWindow
+}
+
+func NewRestartSchedule(windows, blackouts, timeZone string) (
+	s *restartSchedule, e error,
+) {
+	var (
+		blackout restartBlackout
+		item     string
+		window   restartWindow
+	)
+
+	s = &restartSchedule{}
+
+	// e.g. "Europe/London"; "" for UTC
+	s.location, e = time.LoadLocation(timeZone)
+	if e != nil {
+		e = errors.NewNotValid(e, timeZone)
+
+		return
+	}
+
+	// e.g. "Mon-Fri 22:00-06:00; Sat,Sun 00:00-24:00"
+	for _, item = range splitRestartSchedule(windows) {
+		window, e = newRestartWindow(item)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		s.windows = append(s.windows, window)
+	}
+
+	// e.g. "2026-12-24/2027-01-02; 2027-03-31"
+	for _, item = range splitRestartSchedule(blackouts) {
+		blackout, e = newRestartBlackout(item)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		s.blackouts = append(s.blackouts, blackout)
+	}
+
+	return
+}
+
+func (s *restartSchedule) Allows(t time.Time) (allowed bool) {
+	var (
+		blackout restartBlackout
+		window   restartWindow
+	)
+
+	t = t.In(s.location)
+
+	for _, blackout = range s.blackouts {
+		if blackout.covers(t) {
+			return
+		}
+	}
+
+	// restarts are allowed at any time outside blackouts without windows
+	if len(s.windows) == 0 {
+		allowed = true
+
+		return
+	}
+
+	for _, window = range s.windows {
+		if window.covers(t) {
+			allowed = true
+
+			return
+		}
+	}
+
+	return
+}
+
+type restartWindow struct {
+	days  map[time.Weekday]bool // on which windows open
+	start time.Duration         // since midnight
+	end   time.Duration         // since midnight; the next day if <= start
+}
+
+func newRestartWindow(s string) (w restartWindow, e error) {
+	const (
+		daysDefault = "Sun-Sat"
+	)
+
+	var (
+		fields []string
+	)
+
+	fields = strings.Fields(s)
+
+	switch len(fields) {
+	case 1:
+		fields = []string{daysDefault, fields[0]} // every day
+
+	case 2:
+
+	default:
+		e = errors.NotValidf("maintenance window %q", s)
+
+		return
+	}
+
+	w.days, e = parseRestartWeekdays(fields[0])
+	if e != nil {
+		e = errors.Annotatef(e, "maintenance window %q", s)
+
+		return
+	}
+
+	w.start, w.end, e = parseRestartTimes(fields[1])
+	if e != nil {
+		e = errors.Annotatef(e, "maintenance window %q", s)
+
+		return
+	}
+
+	return
+}
+
+func (w restartWindow) covers(t time.Time) bool {
+	var (
+		sinceMidnight time.Duration
+		yesterday     time.Weekday
+	)
+
+	sinceMidnight = time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	if w.start < w.end {
+		return w.days[t.Weekday()] &&
+			sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+
+	// overnight, e.g. "Fri 22:00-06:00" covers early Saturday
+	yesterday = (t.Weekday() + 6) % 7
+
+	return w.days[t.Weekday()] && sinceMidnight >= w.start ||
+		w.days[yesterday] && sinceMidnight < w.end
+}
+
+type restartBlackout struct {
+	from string // dates, inclusive
+	to   string
+}
+
+func newRestartBlackout(s string) (b restartBlackout, e error) {
+	const (
+		rangeSeparator = "/"
+	)
+
+	var (
+		dates []string
+		date  string
+	)
+
+	dates = strings.Split(s, rangeSeparator)
+
+	if len(dates) > 2 {
+		e = errors.NotValidf("blackout %q", s)
+
+		return
+	}
+
+	for _, date = range dates {
+		_, e = time.Parse(restartScheduleDate, date)
+		if e != nil {
+			e = errors.NewNotValid(e, fmt.Sprintf("blackout %q", s))
+
+			return
+		}
+	}
+
+	b = restartBlackout{
+		from: dates[0],
+		to:   dates[len(dates)-1],
+	}
+
+	if b.to < b.from {
+		e = errors.NotValidf("blackout %q ending before it begins", s)
+
+		return
+	}
+
+	return
+}
+
+func (b restartBlackout) covers(t time.Time) bool {
+	var (
+		date string
+	)
+
+	date = t.Format(restartScheduleDate) // sorts as it is dated
+
+	return date >= b.from && date <= b.to
+}
+
+func splitRestartSchedule(s string) (items []string) {
+	var (
+		item string
+	)
+
+	for _, item = range strings.Split(s, restartScheduleSeparator) {
+		item = strings.TrimSpace(item)
+
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return
+}
+
+func parseRestartWeekdays(s string) (days map[time.Weekday]bool, e error) {
+	const (
+		listSeparator  = ","
+		rangeSeparator = "-"
+	)
+
+	var (
+		bounds []string
+		day    time.Weekday
+		first  time.Weekday
+		found  bool
+		item   string
+		last   time.Weekday
+	)
+
+	days = make(map[time.Weekday]bool)
+
+	// e.g. "Mon-Fri", "Sat,Sun", "Fri-Mon"
+	for _, item = range strings.Split(s, listSeparator) {
+		bounds = strings.Split(item, rangeSeparator)
+
+		if len(bounds) > 2 {
+			e = errors.NotValidf("days %q", s)
+
+			return
+		}
+
+		first, found = restartScheduleWeekdays[bounds[0]]
+		if !found {
+			e = errors.NotValidf("day %q", bounds[0])
+
+			return
+		}
+
+		last, found = restartScheduleWeekdays[bounds[len(bounds)-1]]
+		if !found {
+			e = errors.NotValidf("day %q", bounds[len(bounds)-1])
+
+			return
+		}
+
+		for day = first; ; day = (day + 1) % 7 {
+			days[day] = true
+
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func parseRestartTimes(s string) (start, end time.Duration, e error) {
+	const (
+		rangeSeparator = "-"
+	)
+
+	var (
+		bounds []string
+	)
+
+	// e.g. "22:00-06:00", "00:00-24:00"
+	bounds = strings.Split(s, rangeSeparator)
+
+	if len(bounds) != 2 {
+		e = errors.NotValidf("times %q", s)
+
+		return
+	}
+
+	start, e = parseRestartTime(bounds[0])
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	end, e = parseRestartTime(bounds[1])
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	if start == end {
+		e = errors.NotValidf("times %q of no length", s)
+
+		return
+	}
+
+	return
+}
+
+func parseRestartTime(s string) (sinceMidnight time.Duration, e error) {
+	const (
+		format   = "%d:%d"
+		midnight = "24:00"
+	)
+
+	var (
+		hours   int
+		minutes int
+		n       int
+	)
+
+	if s == midnight {
+		sinceMidnight = 24 * time.Hour
+
+		return
+	}
+
+	n, e = fmt.Sscanf(s, format, &hours, &minutes)
+	if e != nil || n != 2 || len(s) != len("00:00") ||
+		hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		e = errors.NotValidf("time %q", s)
+
+		return
+	}
+
+	sinceMidnight = time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute
+
+	return
+}
@@ -0,0 +1,94 @@
+package figwasp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartSchedule(t *testing.T) {
+	const (
+		timeFormat = "Mon 2006-01-02 15:04"
+	)
+
+	type testCase struct {
+		windows   string
+		blackouts string
+		timeZone  string
+		time      string // UTC
+		allowed   bool
+	}
+
+	var (
+		testCases []testCase
+
+		moment   time.Time
+		schedule *restartSchedule
+		test     testCase
+
+		e error
+	)
+
+	testCases = []testCase{
+		{"", "", "", "Wed 2026-10-21 12:00", true}, // no restrictions
+		{"Mon-Fri 22:00-06:00", "", "", "Wed 2026-10-21 23:00", true},
+		{"Mon-Fri 22:00-06:00", "", "", "Thu 2026-10-22 05:59", true},
+		{"Mon-Fri 22:00-06:00", "", "", "Thu 2026-10-22 06:00", false},
+		{"Mon-Fri 22:00-06:00", "", "", "Sat 2026-10-24 05:00", true},
+		{"Mon-Fri 22:00-06:00", "", "", "Sun 2026-10-25 05:00", false},
+		{"Mon-Fri 22:00-06:00", "", "", "Mon 2026-10-19 05:00", false},
+		{"Mon 09:00-10:00; Sat,Sun 00:00-24:00", "", "",
+			"Sun 2026-10-25 15:00", true},
+		{"Mon 09:00-10:00; Sat,Sun 00:00-24:00", "", "",
+			"Mon 2026-10-19 09:30", true},
+		{"Fri-Mon 12:00-13:00", "", "", "Tue 2026-10-20 12:30", false},
+		{"12:00-13:00", "", "", "Tue 2026-10-20 12:30", true},
+		// 09:30 in London is 08:30 UTC in summer time
+		{"09:00-10:00", "", "Europe/London", "Mon 2026-10-19 08:30", true},
+		{"09:00-10:00", "", "Europe/London", "Mon 2026-10-19 09:30", false},
+		// blackouts prevail, in the time zone of the schedule
+		{"", "2026-12-24/2027-01-02", "", "Thu 2026-12-31 12:00", false},
+		{"", "2026-12-24/2027-01-02", "", "Sun 2027-01-03 00:00", true},
+		{"", "2026-12-24", "", "Thu 2026-12-24 23:59", false},
+		{"", "2026-12-24", "America/New_York", "Fri 2026-12-25 01:00", false},
+		{"00:00-24:00", "2026-12-24", "", "Thu 2026-12-24 12:00", false},
+	}
+
+	for _, test = range testCases {
+		schedule, e = NewRestartSchedule(test.windows,
+			test.blackouts,
+			test.timeZone,
+		)
+		if e != nil {
+			t.Error(e)
+		}
+
+		moment, e = time.Parse(timeFormat, test.time)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t,
+			test.allowed,
+			schedule.Allows(moment),
+			test.windows+" "+test.blackouts+" "+test.timeZone+" "+test.time,
+		)
+	}
+
+	for _, test = range []testCase{
+		{windows: "Mon-Fri"},
+		{windows: "Mon-Fri 22:00"},
+		{windows: "Mon-Fri 22:00-22:00"},
+		{windows: "Mon-Fry 22:00-06:00"},
+		{windows: "25:00-06:00"},
+		{windows: "Mon - Fri 22:00-06:00"},
+		{blackouts: "2026-12-24/2026-12-20"},
+		{blackouts: "24/12/2026"},
+		{timeZone: "Nowhere/Special"},
+	} {
+		_, e = NewRestartSchedule(test.windows, test.blackouts, test.timeZone)
+
+		assert.Error(t, e, test)
+	}
+}
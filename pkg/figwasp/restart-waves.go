@@ -0,0 +1,113 @@
+package figwasp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+func OrderRestartWaves(
+	waves map[string]int, after map[string][]string, // by deployment name
+) (
+	ordered [][]string, e error,
+) {
+	const (
+		cycleSeparator = " -> "
+	)
+
+	var (
+		levels   map[string]int
+		level    func(string, []string) (int, error)
+		name     string
+		names    []string
+		byLevel  map[int][]string
+		numbers  []int
+		number   int
+		visiting map[string]bool
+	)
+
+	levels = make(map[string]int)
+
+	visiting = make(map[string]bool)
+
+	// a deployment is restarted in its own wave, and after those it names,
+	// whichever is later; names of deployments not restarted are ignored
+	level = func(name string, path []string) (l int, e error) {
+		var (
+			dependency  string
+			found       bool
+			lDependency int
+		)
+
+		l, found = levels[name]
+		if found {
+			return
+		}
+
+		if visiting[name] {
+			e = errors.NotValidf("restart order cycle %s",
+				strings.Join(append(path, name), cycleSeparator),
+			)
+
+			return
+		}
+
+		visiting[name] = true
+
+		l = waves[name]
+
+		for _, dependency = range after[name] {
+			_, found = waves[dependency]
+			if !found {
+				continue
+			}
+
+			lDependency, e = level(dependency, append(path, name))
+			if e != nil {
+				return
+			}
+
+			if lDependency+1 > l {
+				l = lDependency + 1
+			}
+		}
+
+		visiting[name] = false
+
+		levels[name] = l
+
+		return
+	}
+
+	for name = range waves {
+		names = append(names, name)
+	}
+
+	sort.Strings(names) // for cycles to be reported alike from run to run
+
+	byLevel = make(map[int][]string)
+
+	for _, name = range names {
+		number, e = level(name, nil)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		byLevel[number] = append(byLevel[number], name)
+	}
+
+	for number = range byLevel {
+		numbers = append(numbers, number)
+	}
+
+	sort.Ints(numbers)
+
+	for _, number = range numbers {
+		ordered = append(ordered, byLevel[number])
+	}
+
+	return
+}
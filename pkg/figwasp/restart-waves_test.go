@@ -0,0 +1,75 @@
+package figwasp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderRestartWaves(t *testing.T) {
+	var (
+		ordered [][]string
+
+		e error
+	)
+
+	// without waves or dependencies, all are restarted at once
+	ordered, e = OrderRestartWaves(
+		map[string]int{"backend": 0, "gateway": 0},
+		nil,
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t, [][]string{{"backend", "gateway"}}, ordered)
+
+	ordered, e = OrderRestartWaves(
+		map[string]int{
+			"database": 0,
+			"backend":  0,
+			"worker":   0,
+			"gateway":  0,
+			"batch":    1,
+			"frontend": 5,
+		},
+		map[string][]string{
+			"backend": {"database"},
+			"worker":  {"database", "unknown"}, // not restarted by Figwasp
+			"gateway": {"backend", "worker"},
+		},
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		[][]string{
+			{"database"},
+			{"backend", "batch", "worker"},
+			{"gateway"},
+			{"frontend"},
+		},
+		ordered,
+	)
+
+	_, e = OrderRestartWaves(
+		map[string]int{"a": 0, "b": 0, "c": 0},
+		map[string][]string{
+			"a": {"b"},
+			"b": {"c"},
+			"c": {"a"},
+		},
+	)
+
+	if assert.Error(t, e) {
+		assert.Contains(t, e.Error(), "a -> b -> c -> a")
+	}
+
+	_, e = OrderRestartWaves(
+		map[string]int{"a": 0},
+		map[string][]string{"a": {"a"}},
+	)
+
+	assert.Error(t, e)
+}
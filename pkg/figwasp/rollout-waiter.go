@@ -0,0 +1,175 @@
+package figwasp
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedAppsV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	"k8s.io/client-go/rest"
+)
+
+type deploymentRolloutWaiter struct {
+	deployments typedAppsV1.DeploymentInterface
+	interval    time.Duration
+}
+
+func NewDeploymentRolloutWaiter(config *rest.Config, namespace string) (
+	w *deploymentRolloutWaiter, e error,
+) {
+	const (
+		interval = time.Second * 2
+	)
+
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	w = &deploymentRolloutWaiter{
+		deployments: clientset.AppsV1().Deployments(namespace),
+		interval:    interval,
+	}
+
+	return
+}
+
+func (w *deploymentRolloutWaiter) WaitForRollout(
+	deploymentName string, ctx context.Context,
+) (
+	e error,
+) {
+	e = wait.PollImmediateUntil(w.interval,
+		func() (done bool, e error) {
+			return w.rolledOut(deploymentName, ctx)
+		},
+		ctx.Done(),
+	)
+	if e != nil {
+		e = errors.Annotatef(e, "rollout of deployment %s", deploymentName)
+
+		return
+	}
+
+	return
+}
+
+func (w *deploymentRolloutWaiter) WatchRollout(
+	deploymentName string, period time.Duration, ctx context.Context,
+) (
+	e error,
+) {
+	var (
+		done   bool
+		ticker *time.Ticker
+		timer  *time.Timer
+	)
+
+	ticker = time.NewTicker(w.interval)
+
+	defer ticker.Stop()
+
+	timer = time.NewTimer(period)
+
+	defer timer.Stop()
+
+	// the rollout must stay complete, its pods available, throughout
+	for {
+		done, e = w.rolledOut(deploymentName, ctx)
+		if e != nil {
+			e = errors.Trace(e)
+
+			return
+		}
+
+		if !done {
+			e = errors.Errorf("deployment %s unavailable within %s of rollout",
+				deploymentName,
+				period,
+			)
+
+			return
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+
+		case <-timer.C:
+			return
+
+		case <-ctx.Done():
+			e = errors.Trace(
+				ctx.Err(),
+			)
+
+			return
+		}
+	}
+}
+
+func (w *deploymentRolloutWaiter) rolledOut(
+	deploymentName string, ctx context.Context,
+) (
+	done bool, e error,
+) {
+	const (
+		progressDeadlineExceeded = "ProgressDeadlineExceeded"
+	)
+
+	var (
+		condition  appsV1.DeploymentCondition
+		deployment *appsV1.Deployment
+		replicas   int32
+	)
+
+	deployment, e = w.deployments.Get(ctx,
+		deploymentName,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	// as "kubectl rollout status"
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return
+	}
+
+	for _, condition = range deployment.Status.Conditions {
+		if condition.Type == appsV1.DeploymentProgressing &&
+			condition.Status == v1.ConditionFalse &&
+			condition.Reason == progressDeadlineExceeded {
+			e = errors.Errorf("deployment %s exceeded its progress deadline",
+				deploymentName,
+			)
+
+			return
+		}
+	}
+
+	replicas = 1
+
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	done = deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.Replicas <= deployment.Status.UpdatedReplicas &&
+		deployment.Status.AvailableReplicas >= deployment.Status.UpdatedReplicas
+
+	return
+}
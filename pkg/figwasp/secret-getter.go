@@ -0,0 +1,59 @@
+package figwasp
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+type secretGetter struct {
+	secrets typedCoreV1.SecretInterface
+}
+
+func NewSecretGetter(config *rest.Config, namespace string) (
+	g *secretGetter, e error,
+) {
+	var (
+		clientset *kubernetes.Clientset
+	)
+
+	clientset, e = kubernetes.NewForConfig(config)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	g = &secretGetter{
+		secrets: clientset.CoreV1().Secrets(namespace),
+	}
+
+	return
+}
+
+func (g *secretGetter) GetSecret(name string, ctx context.Context) (
+	secret coreV1.Secret, e error,
+) {
+	var (
+		secretPointer *coreV1.Secret
+	)
+
+	secretPointer, e = g.secrets.Get(ctx,
+		name,
+		metaV1.GetOptions{},
+	)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	secret = *secretPointer
+
+	return
+}
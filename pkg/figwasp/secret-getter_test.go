@@ -0,0 +1,101 @@
+package figwasp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/figwasp/figwasp/test/pkg/clusters"
+	"github.com/figwasp/figwasp/test/pkg/secrets"
+)
+
+func TestSecretGetter(t *testing.T) {
+	const (
+		clusterName  = "test-secret-getter-cluster"
+		nodeImageRef = "kindest/node:v1.23.3"
+
+		secretName = "test-secret"
+
+		registryAddress = "docker.io"
+
+		username = "username"
+		password = "password"
+
+		masterURL = ""
+	)
+
+	var (
+		cluster *clusters.KindCluster
+
+		secret *secrets.KubernetesDockerRegistrySecret
+
+		config *rest.Config
+		getter *secretGetter
+
+		got v1.Secret
+
+		e error
+	)
+
+	cluster, e = clusters.NewKindCluster(nodeImageRef, clusterName)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer cluster.Destroy()
+
+	secret, e = secrets.NewKubernetesDockerRegistrySecret(
+		cluster.KubeconfigPath(),
+		secretName,
+		registryAddress,
+		username,
+		password,
+		secrets.WithNamespace(metaV1.NamespaceSystem),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	defer secret.Destroy()
+
+	config, e = clientcmd.BuildConfigFromFlags(
+		masterURL,
+		cluster.KubeconfigPath(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	getter, e = NewSecretGetter(config, metaV1.NamespaceSystem)
+	if e != nil {
+		t.Error(e)
+	}
+
+	got, e = getter.GetSecret(secretName,
+		context.Background(),
+	)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.Equal(t,
+		v1.SecretTypeDockerConfigJson,
+		got.Type,
+	)
+
+	getter, e = NewSecretGetter(config, v1.NamespaceDefault)
+	if e != nil {
+		t.Error(e)
+	}
+
+	_, e = getter.GetSecret(secretName,
+		context.Background(),
+	)
+
+	assert.Error(t, e)
+}
@@ -0,0 +1,71 @@
+package figwasp
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/juju/errors"
+)
+
+type semverTagPolicy struct {
+	constraints *semver.Constraints
+}
+
+func NewSemverTagPolicy(constraint string) (p *semverTagPolicy, e error) {
+	p = &semverTagPolicy{}
+
+	// e.g. "~1.2" (>= 1.2.0, < 1.3.0), "^1" (>= 1.0.0, < 2.0.0), ">= 1.2.3"
+	p.constraints, e = semver.NewConstraint(constraint)
+	if e != nil {
+		e = errors.NewNotValid(e, constraint)
+
+		return
+	}
+
+	return
+}
+
+func (p *semverTagPolicy) SelectTag(currentTag string, tags []string) (
+	selectedTag string,
+) {
+	var (
+		current  *semver.Version
+		selected *semver.Version
+		tag      string
+		version  *semver.Version
+
+		e error
+	)
+
+	selectedTag = currentTag
+
+	// tags that are not versions, e.g. "latest", are left to digest checks
+	current, e = semver.NewVersion(currentTag)
+	if e != nil {
+		return
+	}
+
+	for _, tag = range tags {
+		version, e = semver.NewVersion(tag)
+		if e != nil || !p.constraints.Check(version) ||
+			!version.GreaterThan(current) {
+			continue
+		}
+
+		// the highest version is selected, and of equal versions,
+		// e.g. "1.3" and "1.3.0", the more specific tag
+		if selected != nil {
+			switch version.Compare(selected) {
+			case -1:
+				continue
+
+			case 0:
+				if len(tag) <= len(selectedTag) {
+					continue
+				}
+			}
+		}
+
+		selected, selectedTag = version, tag
+	}
+
+	return
+}
@@ -0,0 +1,57 @@
+package figwasp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemverTagPolicy(t *testing.T) {
+	type testCase struct {
+		constraint string
+		currentTag string
+		selected   string
+	}
+
+	var (
+		testCases []testCase
+
+		policy *semverTagPolicy
+		tags   []string
+		test   testCase
+
+		e error
+	)
+
+	tags = []string{
+		"latest", "1", "1.2", "1.2.3", "1.2.4", "1.2.10", "1.3", "1.3.0",
+		"1.4.0-rc.1", "2.0.0", "v2.1.0", "main-abc1234",
+	}
+
+	testCases = []testCase{
+		{"~1.2", "1.2.3", "1.2.10"},     // patch releases only
+		{"^1", "1.2.3", "1.3.0"},        // more specific of "1.3" and "1.3.0"
+		{">= 1.2.3", "1.2.3", "v2.1.0"}, // "v" prefix allowed
+		{"~1.2", "1.2.10", "1.2.10"},    // already the highest
+		{"^1", "1.3.5", "1.3.5"},        // never downgraded
+		{"^1", "latest", "latest"},      // not a version
+		{"~1.4.0-0", "1.4.0-rc.0", "1.4.0-rc.1"},
+	}
+
+	for _, test = range testCases {
+		policy, e = NewSemverTagPolicy(test.constraint)
+		if e != nil {
+			t.Error(e)
+		}
+
+		assert.Equal(t,
+			test.selected,
+			policy.SelectTag(test.currentTag, tags),
+			test.constraint+" from "+test.currentTag,
+		)
+	}
+
+	_, e = NewSemverTagPolicy("not a constraint")
+
+	assert.Error(t, e)
+}
@@ -0,0 +1,80 @@
+package figwasp
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type timestampTagPolicy struct {
+	pattern *tagPattern
+}
+
+func NewTimestampTagPolicy(pattern string) (p *timestampTagPolicy, e error) {
+	p = &timestampTagPolicy{}
+
+	p.pattern, e = newTagPattern(pattern)
+	if e != nil {
+		e = errors.Trace(e)
+
+		return
+	}
+
+	return
+}
+
+func (p *timestampTagPolicy) FilterTags(tags []string) (filtered []string) {
+	var (
+		tag string
+	)
+
+	// as the creation time of each tag costs a request to the registry
+	for _, tag = range tags {
+		if p.pattern.match(tag) {
+			filtered = append(filtered, tag)
+		}
+	}
+
+	return
+}
+
+func (p *timestampTagPolicy) SelectTag(
+	currentTag string, created map[string]time.Time, // by tag
+) (
+	selectedTag string,
+) {
+	var (
+		createdAt time.Time
+		found     bool
+		selected  time.Time
+		tag       string
+	)
+
+	selectedTag = currentTag
+
+	if !p.pattern.match(currentTag) {
+		return
+	}
+
+	selected, found = created[currentTag]
+	if !found {
+		return
+	}
+
+	for tag, createdAt = range created {
+		if !p.pattern.match(tag) || createdAt.Before(selected) {
+			continue
+		}
+
+		// of tags created at once, e.g. "main-ab12cd3" and "v1.2.3",
+		// the current tag is kept, otherwise the last alphabetically
+		if createdAt.Equal(selected) &&
+			(selectedTag == currentTag || tag <= selectedTag) {
+			continue
+		}
+
+		selected, selectedTag = createdAt, tag
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package figwasp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampTagPolicy(t *testing.T) {
+	const (
+		pattern = `^main-`
+	)
+
+	var (
+		created map[string]time.Time
+		day     time.Time
+		policy  *timestampTagPolicy
+
+		e error
+	)
+
+	day = time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	created = map[string]time.Time{
+		"main-ab12cd3": day,
+		"main-ff00ee1": day.Add(-time.Hour),
+		"main-0a1b2c3": day.Add(-2 * time.Hour),
+		"main-9f8e7d6": day.Add(-2 * time.Hour),
+		"latest":       day.Add(time.Hour),
+	}
+
+	policy, e = NewTimestampTagPolicy(pattern)
+	if e != nil {
+		t.Error(e)
+	}
+
+	assert.ElementsMatch(t,
+		[]string{"main-ab12cd3", "main-0a1b2c3"},
+		policy.FilterTags(
+			[]string{"latest", "main-ab12cd3", "v1.2.3", "main-0a1b2c3"},
+		),
+	)
+
+	// the most recently created within the pattern
+	assert.Equal(t, "main-ab12cd3", policy.SelectTag("main-ff00ee1", created))
+	assert.Equal(t, "main-ab12cd3", policy.SelectTag("main-ab12cd3", created))
+
+	// of those created at once, the current tag is kept
+	delete(created, "main-ab12cd3")
+	delete(created, "main-ff00ee1")
+
+	assert.Equal(t, "main-0a1b2c3", policy.SelectTag("main-0a1b2c3", created))
+	assert.Equal(t, "main-9f8e7d6", policy.SelectTag("main-9f8e7d6", created))
+
+	// tags outside the pattern, or of unknown age, are kept
+	assert.Equal(t, "latest", policy.SelectTag("latest", created))
+	assert.Equal(t, "main-1234567", policy.SelectTag("main-1234567", created))
+}
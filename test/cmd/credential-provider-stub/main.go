@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+)
+
+// A kubelet credential provider plugin that returns, for the registry of the
+// requested image, the username in environment variable STUB_USERNAME and
+// the password given as its first argument. Each invocation is recorded
+// as a line appended to the file at STUB_INVOCATIONS_PATH, if set.
+
+type request struct {
+	APIVersion string `json:"apiVersion"`
+	Image      string `json:"image"`
+}
+
+type response struct {
+	APIVersion    string                `json:"apiVersion"`
+	Kind          string                `json:"kind"`
+	CacheKeyType  string                `json:"cacheKeyType"`
+	CacheDuration string                `json:"cacheDuration,omitempty"`
+	Auth          map[string]authConfig `json:"auth"`
+}
+
+type authConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func main() {
+	const (
+		cacheDurationKey   = "STUB_CACHE_DURATION"
+		invocationsPathKey = "STUB_INVOCATIONS_PATH"
+		usernameKey        = "STUB_USERNAME"
+
+		cacheKeyType = "Registry"
+		kind         = "CredentialProviderResponse"
+
+		pathSeparator = "/"
+	)
+
+	var (
+		file     *os.File
+		registry string
+		req      request
+		res      response
+
+		e error
+	)
+
+	if len(os.Args) < 2 {
+		log.Fatalln("password argument required")
+	}
+
+	e = json.NewDecoder(os.Stdin).Decode(&req)
+	if e != nil {
+		log.Fatalln(e)
+	}
+
+	if os.Getenv(invocationsPathKey) != "" {
+		file, e = os.OpenFile(
+			os.Getenv(invocationsPathKey),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+			0600,
+		)
+		if e != nil {
+			log.Fatalln(e)
+		}
+
+		_, e = file.WriteString(req.Image + "\n")
+		if e != nil {
+			log.Fatalln(e)
+		}
+
+		file.Close()
+	}
+
+	registry = strings.SplitN(req.Image, pathSeparator, 2)[0]
+
+	res = response{
+		APIVersion:    req.APIVersion,
+		Kind:          kind,
+		CacheKeyType:  cacheKeyType,
+		CacheDuration: os.Getenv(cacheDurationKey),
+		Auth: map[string]authConfig{
+			registry: {
+				Username: os.Getenv(usernameKey),
+				Password: os.Args[1],
+			},
+		},
+	}
+
+	e = json.NewEncoder(os.Stdout).Encode(res)
+	if e != nil {
+		log.Fatalln(e)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/figwasp/figwasp/pkg/figwasp"
+)
+
+// Prints the digest of the image given as first argument, trusting the CA
+// certificate at the path given as second argument. Proxies are taken from
+// the environment, as by Figwasp, which is read once per process.
+
+type imageDigestRetriever interface {
+	RetrieveImageDigest(string, context.Context) (string, error)
+	Destroy() error
+}
+
+func main() {
+	var (
+		imageDigestString string
+		retriever         imageDigestRetriever
+
+		e error
+	)
+
+	if len(os.Args) < 3 {
+		log.Fatalln("image reference and CA certificate arguments required")
+	}
+
+	retriever, e = figwasp.NewImageDigestRetriever(
+		figwasp.WithSelfSignedTLSCertificate(os.Args[2]),
+	)
+	if e != nil {
+		log.Fatalln(e)
+	}
+
+	defer retriever.Destroy()
+
+	imageDigestString, e = retriever.RetrieveImageDigest(os.Args[1],
+		context.Background(),
+	)
+	if e != nil {
+		log.Fatalln(e)
+	}
+
+	fmt.Print(imageDigestString)
+}
@@ -555,10 +555,13 @@ func figwaspIsRunningInAPod(
 	const (
 		apiGroup0 = ""
 		apiGroup1 = "apps"
+		apiGroup2 = "policy"
 		resource0 = "deployments"
 		resource1 = "replicasets"
 		resource2 = "pods"
 		resource3 = "secrets"
+		resource4 = "serviceaccounts"
+		resource5 = "poddisruptionbudgets"
 		verb0     = "get"
 		verb1     = "update"
 		verb2     = "list"
@@ -596,9 +599,14 @@ func figwaspIsRunningInAPod(
 			[]string{resource2},
 		),
 		permissions.WithPolicyRule(
-			[]string{verb2},
+			[]string{verb0},
 			[]string{apiGroup0},
-			[]string{resource3},
+			[]string{resource3, resource4},
+		),
+		permissions.WithPolicyRule(
+			[]string{verb2},
+			[]string{apiGroup2},
+			[]string{resource5},
 		),
 	)
 	if e != nil {
@@ -177,6 +177,18 @@ func WithExtendedKeyUsageForServerAuth() (option tlsCertificateOption) {
 	return
 }
 
+func WithExtendedKeyUsageForClientAuth() (option tlsCertificateOption) {
+	option = func(c *TLSCertificate) (e error) {
+		c.certTemplate.ExtKeyUsage = append(c.certTemplate.ExtKeyUsage,
+			x509.ExtKeyUsageClientAuth,
+		)
+
+		return
+	}
+
+	return
+}
+
 func WithIPAddress(address string) (option tlsCertificateOption) {
 	option = func(c *TLSCertificate) (e error) {
 		c.certTemplate.IPAddresses = append(c.certTemplate.IPAddresses,
@@ -188,3 +200,15 @@ func WithIPAddress(address string) (option tlsCertificateOption) {
 
 	return
 }
+
+func WithDNSName(name string) (option tlsCertificateOption) {
+	option = func(c *TLSCertificate) (e error) {
+		c.certTemplate.DNSNames = append(c.certTemplate.DNSNames,
+			name,
+		)
+
+		return
+	}
+
+	return
+}
@@ -186,6 +186,20 @@ func WithLabel(key, value string) (option kubernetesDeploymentOption) {
 	return
 }
 
+func WithAnnotation(key, value string) (option kubernetesDeploymentOption) {
+	option = func(d *KubernetesDeployment) (e error) {
+		if d.deployment.ObjectMeta.Annotations == nil {
+			d.deployment.ObjectMeta.Annotations = make(map[string]string)
+		}
+
+		d.deployment.ObjectMeta.Annotations[key] = value
+
+		return
+	}
+
+	return
+}
+
 func WithContainerWithTCPPorts(name, imageRef string, ports ...int32) (
 	option kubernetesDeploymentOption,
 ) {
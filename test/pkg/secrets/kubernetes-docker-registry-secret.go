@@ -20,6 +20,7 @@ type KubernetesDockerRegistrySecret struct {
 
 func NewKubernetesDockerRegistrySecret(
 	kubeconfigPath, secretName, registryAddress, username, password string,
+	options ...kubernetesDockerRegistrySecretOption,
 ) (
 	s *KubernetesDockerRegistrySecret, e error,
 ) {
@@ -32,6 +33,7 @@ func NewKubernetesDockerRegistrySecret(
 		config    *rest.Config
 
 		dockerConfigJSON create.DockerConfigJSON
+		option           kubernetesDockerRegistrySecretOption
 	)
 
 	config, e = clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
@@ -45,18 +47,25 @@ func NewKubernetesDockerRegistrySecret(
 	}
 
 	s = &KubernetesDockerRegistrySecret{
-		secrets: clientset.CoreV1().Secrets(
-			coreV1.NamespaceDefault,
-		),
 		secret: &coreV1.Secret{
 			ObjectMeta: metaV1.ObjectMeta{
-				Name: secretName,
+				Name:      secretName,
+				Namespace: coreV1.NamespaceDefault,
 			},
 			Data: make(map[string][]byte),
 			Type: coreV1.SecretTypeDockerConfigJson,
 		},
 	}
 
+	for _, option = range options {
+		e = option(s)
+		if e != nil {
+			return
+		}
+	}
+
+	s.secrets = clientset.CoreV1().Secrets(s.secret.Namespace)
+
 	dockerConfigJSON.Auths = map[string]create.DockerConfigEntry{
 		registryAddress: {
 			Username: username,
@@ -95,3 +104,19 @@ func (s *KubernetesDockerRegistrySecret) Destroy() (e error) {
 
 	return
 }
+
+type kubernetesDockerRegistrySecretOption func(
+	*KubernetesDockerRegistrySecret,
+) error
+
+func WithNamespace(namespace string) (
+	option kubernetesDockerRegistrySecretOption,
+) {
+	option = func(s *KubernetesDockerRegistrySecret) (e error) {
+		s.secret.ObjectMeta.Namespace = namespace
+
+		return
+	}
+
+	return
+}
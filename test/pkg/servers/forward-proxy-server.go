@@ -0,0 +1,192 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+type ForwardProxyServer struct {
+	server   http.Server
+	aliases  map[string]string // host to IP address
+	mutex    *sync.Mutex
+	requests int
+}
+
+func NewForwardProxyServer(options ...forwardProxyServerOption) (
+	s *ForwardProxyServer, e error,
+) {
+	var (
+		option forwardProxyServerOption
+	)
+
+	s = &ForwardProxyServer{
+		aliases: make(map[string]string),
+		mutex:   new(sync.Mutex),
+	}
+
+	for _, option = range options {
+		e = option(s)
+		if e != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *ForwardProxyServer) ServeAtAddress(address net.TCPAddr) (e error) {
+	var (
+		listener net.Listener
+	)
+
+	s.server.Handler = http.HandlerFunc(s.handle)
+
+	listener, e = net.Listen(
+		address.Network(),
+		address.String(),
+	)
+	if e != nil {
+		return
+	}
+
+	go s.server.Serve(listener)
+
+	for {
+		_, e = net.Dial(
+			address.Network(),
+			address.String(),
+		)
+		if e == nil {
+			return
+		}
+	}
+}
+
+func (s *ForwardProxyServer) Requests() int {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	return s.requests
+}
+
+func (s *ForwardProxyServer) Close() (e error) {
+	return s.server.Close()
+}
+
+func (s *ForwardProxyServer) handle(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		established = "HTTP/1.1 200 Connection established\r\n\r\n"
+	)
+
+	var (
+		buffered *bufio.ReadWriter
+		client   net.Conn
+		key      string
+		response *http.Response
+		server   net.Conn
+		values   []string
+
+		e error
+	)
+
+	s.mutex.Lock()
+
+	s.requests++
+
+	s.mutex.Unlock()
+
+	if request.Method != http.MethodConnect {
+		request.RequestURI = ""
+
+		response, e = (&http.Transport{DialContext: s.dial}).RoundTrip(request)
+		if e != nil {
+			writer.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		defer response.Body.Close()
+
+		for key, values = range response.Header {
+			writer.Header()[key] = values
+		}
+
+		writer.WriteHeader(response.StatusCode)
+
+		io.Copy(writer, response.Body)
+
+		return
+	}
+
+	server, e = s.dial(request.Context(), "tcp", request.Host)
+	if e != nil {
+		writer.WriteHeader(http.StatusBadGateway)
+
+		return
+	}
+
+	client, buffered, e = writer.(http.Hijacker).Hijack()
+	if e != nil {
+		server.Close()
+
+		return
+	}
+
+	io.WriteString(client, established)
+
+	go func() {
+		io.Copy(server, buffered)
+
+		server.Close()
+	}()
+
+	io.Copy(client, server)
+
+	client.Close()
+}
+
+func (s *ForwardProxyServer) dial(
+	ctx context.Context, network, address string,
+) (
+	conn net.Conn, e error,
+) {
+	var (
+		dialer net.Dialer
+		host   string
+		port   string
+	)
+
+	host, port, e = net.SplitHostPort(address)
+	if e != nil {
+		return
+	}
+
+	if s.aliases[host] != "" {
+		host = s.aliases[host]
+	}
+
+	conn, e = dialer.DialContext(ctx, network,
+		net.JoinHostPort(host, port),
+	)
+
+	return
+}
+
+type forwardProxyServerOption func(*ForwardProxyServer) error
+
+func WithHostAlias(host, address string) (option forwardProxyServerOption) {
+	option = func(s *ForwardProxyServer) (e error) {
+		s.aliases[host] = address
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,516 @@
+package servers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	manifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	ociManifestType   = "application/vnd.oci.image.manifest.v1+json"
+	signatureSuffix   = ".sig"
+	manifestPathInfix = "/manifests/"
+	blobsPathInfix    = "/blobs/"
+	tagsPathSuffix    = "/tags/list"
+	tokenPath         = "/token"
+)
+
+type RegistryServer struct {
+	server   http.Server
+	config   []byte
+	manifest []byte
+	mutex    *sync.Mutex
+	requests int
+	script   []ScriptedResponse
+	advice   ScriptedResponse // of the last scripted response, asked once
+	tags     []string
+
+	signer            func(payload []byte) (signature []byte, e error)
+	signatureManifest []byte
+	signaturePayload  []byte
+
+	pathToCertPEM string
+	pathToKeyPEM  string
+
+	accessToken   string
+	identityToken string
+}
+
+type ScriptedResponse struct {
+	StatusCode int
+	RetryAfter string
+}
+
+func NewRegistryServer(options ...registryServerOption) (
+	s *RegistryServer, e error,
+) {
+	const (
+		config         = `{}`
+		manifestFormat = `{` +
+			`"schemaVersion":2,` +
+			`"mediaType":"` + manifestMediaType + `",` +
+			`"config":{` +
+			`"mediaType":"application/vnd.docker.container.image.v1+json",` +
+			`"size":%d,` +
+			`"digest":"%s"` +
+			`},` +
+			`"layers":[]` +
+			`}`
+	)
+
+	var (
+		option registryServerOption
+	)
+
+	s = &RegistryServer{
+		config: []byte(config),
+		mutex:  new(sync.Mutex),
+	}
+
+	for _, option = range options {
+		e = option(s)
+		if e != nil {
+			return
+		}
+	}
+
+	s.manifest = []byte(
+		fmt.Sprintf(manifestFormat,
+			len(s.config),
+			digest.FromBytes(s.config),
+		),
+	)
+
+	if s.signer != nil {
+		e = s.sign()
+		if e != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *RegistryServer) sign() (e error) {
+	const (
+		payloadFormat = `{"critical":{` +
+			`"identity":{"docker-reference":""},` +
+			`"image":{"docker-manifest-digest":"%s"},` +
+			`"type":"cosign container image signature"` +
+			`},"optional":null}`
+		manifestFormat = `{` +
+			`"schemaVersion":2,` +
+			`"mediaType":"` + ociManifestType + `",` +
+			`"config":{` +
+			`"mediaType":"application/vnd.oci.image.config.v1+json",` +
+			`"size":%d,` +
+			`"digest":"%s"` +
+			`},` +
+			`"layers":[{` +
+			`"mediaType":"application/vnd.dev.cosign.simplesigning.v1+json",` +
+			`"size":%d,` +
+			`"digest":"%s",` +
+			`"annotations":{"dev.cosignproject.cosign/signature":"%s"}` +
+			`}]` +
+			`}`
+	)
+
+	var (
+		signature []byte
+	)
+
+	// as pushed by "cosign sign", to the tag "sha256-<hex>.sig"
+	s.signaturePayload = []byte(
+		fmt.Sprintf(payloadFormat,
+			s.ManifestDigest(),
+		),
+	)
+
+	signature, e = s.signer(s.signaturePayload)
+	if e != nil {
+		return
+	}
+
+	s.signatureManifest = []byte(
+		fmt.Sprintf(manifestFormat,
+			len(s.config),
+			digest.FromBytes(s.config),
+			len(s.signaturePayload),
+			digest.FromBytes(s.signaturePayload),
+			base64.StdEncoding.EncodeToString(signature),
+		),
+	)
+
+	return
+}
+
+func (s *RegistryServer) ServeAtAddress(address net.TCPAddr) (e error) {
+	var (
+		listener net.Listener
+	)
+
+	s.server.Handler = http.HandlerFunc(s.handle)
+
+	listener, e = net.Listen(
+		address.Network(),
+		address.String(),
+	)
+	if e != nil {
+		return
+	}
+
+	if s.pathToCertPEM == "" {
+		go s.server.Serve(listener)
+
+	} else {
+		go s.server.ServeTLS(listener, s.pathToCertPEM, s.pathToKeyPEM)
+	}
+
+	for {
+		_, e = net.Dial(
+			address.Network(),
+			address.String(),
+		)
+		if e == nil {
+			return
+		}
+	}
+}
+
+func (s *RegistryServer) ManifestDigest() string {
+	return digest.FromBytes(s.manifest).String()
+}
+
+func (s *RegistryServer) ManifestRequests() int {
+	s.mutex.Lock()
+
+	defer s.mutex.Unlock()
+
+	return s.requests
+}
+
+func (s *RegistryServer) Close() (e error) {
+	return s.server.Close()
+}
+
+func (s *RegistryServer) handle(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		retryAfterKey  = "Retry-After"
+		contentTypeKey = "Content-Type"
+	)
+
+	var (
+		response ScriptedResponse
+	)
+
+	if request.URL.Path == tokenPath {
+		s.handleToken(writer, request)
+
+		return
+	}
+
+	if !s.authorized(request) {
+		s.challenge(writer, request)
+
+		return
+	}
+
+	if strings.HasSuffix(request.URL.Path, tagsPathSuffix) {
+		s.handleTags(writer, request)
+
+		return
+	}
+
+	if strings.Contains(request.URL.Path, blobsPathInfix) {
+		if s.signaturePayload != nil && strings.HasSuffix(request.URL.Path,
+			digest.FromBytes(s.signaturePayload).String(),
+		) {
+			writer.Write(s.signaturePayload)
+
+			return
+		}
+
+		writer.Write(s.config) // the only other blob
+
+		return
+	}
+
+	if strings.HasSuffix(request.URL.Path, signatureSuffix) {
+		s.handleSignature(writer, request)
+
+		return
+	}
+
+	if !strings.Contains(request.URL.Path, manifestPathInfix) {
+		s.mutex.Lock()
+
+		if request.Method == http.MethodHead {
+			response, s.advice = s.advice, ScriptedResponse{}
+		}
+
+		s.mutex.Unlock()
+
+		if response.StatusCode != 0 {
+			writer.Header().Set(retryAfterKey, response.RetryAfter)
+
+			writer.WriteHeader(response.StatusCode)
+
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK) // API version check
+
+		return
+	}
+
+	s.mutex.Lock()
+
+	s.requests++
+
+	if len(s.script) > 0 {
+		response, s.script = s.script[0], s.script[1:]
+
+		if response.RetryAfter != "" {
+			s.advice = response
+		}
+	}
+
+	s.mutex.Unlock()
+
+	if response.StatusCode != 0 {
+		if response.RetryAfter != "" {
+			writer.Header().Set(retryAfterKey, response.RetryAfter)
+		}
+
+		writer.WriteHeader(response.StatusCode)
+
+		return
+	}
+
+	writer.Header().Set(contentTypeKey, manifestMediaType)
+
+	writer.Write(s.manifest)
+}
+
+func (s *RegistryServer) handleSignature(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		contentTypeKey = "Content-Type"
+	)
+
+	if s.signatureManifest == nil {
+		writer.WriteHeader(http.StatusNotFound) // image not signed
+
+		return
+	}
+
+	writer.Header().Set(contentTypeKey, ociManifestType)
+
+	writer.Write(s.signatureManifest)
+}
+
+func (s *RegistryServer) authorized(request *http.Request) bool {
+	const (
+		authorizationKey    = "Authorization"
+		authorizationPrefix = "Bearer "
+	)
+
+	return s.accessToken == "" ||
+		request.Header.Get(authorizationKey) == authorizationPrefix+s.accessToken
+}
+
+func (s *RegistryServer) challenge(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		challengeFormat = `Bearer realm="https://%s%s",service="%s"`
+		challengeKey    = "WWW-Authenticate"
+	)
+
+	writer.Header().Set(challengeKey,
+		fmt.Sprintf(challengeFormat, request.Host, tokenPath, request.Host),
+	)
+
+	writer.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *RegistryServer) handleToken(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		grantTypeKey     = "grant_type"
+		grantType        = "refresh_token"
+		refreshTokenKey  = "refresh_token"
+		contentTypeKey   = "Content-Type"
+		contentTypeValue = "application/json"
+	)
+
+	var (
+		e error
+	)
+
+	// only the OAuth2 refresh_token grant with the identity token succeeds
+	e = request.ParseForm()
+	if e != nil || request.Method != http.MethodPost ||
+		request.PostForm.Get(grantTypeKey) != grantType ||
+		request.PostForm.Get(refreshTokenKey) != s.identityToken {
+		writer.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	writer.Header().Set(contentTypeKey, contentTypeValue)
+
+	json.NewEncoder(writer).Encode(
+		map[string]interface{}{
+			"access_token": s.accessToken,
+			"expires_in":   300,
+		},
+	)
+}
+
+func (s *RegistryServer) handleTags(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	const (
+		contentTypeKey   = "Content-Type"
+		contentTypeValue = "application/json"
+		pathPrefix       = "/v2/"
+	)
+
+	writer.Header().Set(contentTypeKey, contentTypeValue)
+
+	json.NewEncoder(writer).Encode(
+		map[string]interface{}{
+			"name": strings.TrimSuffix(
+				strings.TrimPrefix(request.URL.Path, pathPrefix),
+				tagsPathSuffix,
+			),
+			"tags": s.tags,
+		},
+	)
+}
+
+type registryServerOption func(*RegistryServer) error
+
+func WithScriptedResponses(responses ...ScriptedResponse) (
+	option registryServerOption,
+) {
+	option = func(s *RegistryServer) (e error) {
+		s.script = append(s.script, responses...)
+
+		return
+	}
+
+	return
+}
+
+func WithImageCreated(created time.Time) (option registryServerOption) {
+	option = func(s *RegistryServer) (e error) {
+		s.config, e = json.Marshal(
+			map[string]interface{}{
+				"created": created,
+			},
+		)
+		if e != nil {
+			return
+		}
+
+		return
+	}
+
+	return
+}
+
+func WithSignature(signer func(payload []byte) ([]byte, error)) (
+	option registryServerOption,
+) {
+	option = func(s *RegistryServer) (e error) {
+		s.signer = signer // of the manifest, once the manifest is made
+
+		return
+	}
+
+	return
+}
+
+func WithTags(tags ...string) (option registryServerOption) {
+	option = func(s *RegistryServer) (e error) {
+		s.tags = append(s.tags, tags...)
+
+		return
+	}
+
+	return
+}
+
+func WithTransportLayerSecurity(pathToCertPEM, pathToKeyPEM string) (
+	option registryServerOption,
+) {
+	option = func(s *RegistryServer) (e error) {
+		s.pathToCertPEM = pathToCertPEM
+
+		s.pathToKeyPEM = pathToKeyPEM
+
+		return
+	}
+
+	return
+}
+
+func WithTokenAuthentication(identityToken, accessToken string) (
+	option registryServerOption,
+) {
+	option = func(s *RegistryServer) (e error) {
+		s.identityToken = identityToken
+
+		s.accessToken = accessToken
+
+		return
+	}
+
+	return
+}
+
+func WithClientCertificateAuthority(pathToCACertPEM string) (
+	option registryServerOption,
+) {
+	option = func(s *RegistryServer) (e error) {
+		var (
+			caCertPEM []byte
+			pool      *x509.CertPool
+		)
+
+		caCertPEM, e = ioutil.ReadFile(pathToCACertPEM)
+		if e != nil {
+			return
+		}
+
+		pool = x509.NewCertPool()
+
+		pool.AppendCertsFromPEM(caCertPEM)
+
+		s.server.TLSConfig = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+
+		return
+	}
+
+	return
+}